@@ -1,6 +1,11 @@
 package storages
 
-import "io"
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+)
 
 // Key-value writer
 type Writer interface {
@@ -48,6 +53,13 @@ type BatchedStorage interface {
 	BatchWriter() Writer
 }
 
+// Batch writer (returned by BatchedStorage) that can also remove keys in the same batch
+type BatchDeleter interface {
+	Writer
+	// Remove key in batch
+	Del(key []byte) error
+}
+
 // Nested storage with namespace support (implementation defined).
 // Namespaces and regular values may live in a same key-space.
 type NamespacedStorage interface {
@@ -60,6 +72,42 @@ type NamespacedStorage interface {
 	DelNamespace(name []byte) error
 }
 
+// Namespaced storage that can open existent namespace without creating it
+type ExistingNamespacedStorage interface {
+	NamespacedStorage
+	// Get nested storage only if namespace exists, otherwise os.ErrNotExist
+	ExistingNamespace(name []byte) (Storage, error)
+}
+
+// Storage that can iterate over keys with prefix more efficiently than full scan
+type PrefixedStorage interface {
+	Storage
+	// Iterate over keys that starts with prefix
+	KeysPrefix(prefix []byte, handler func(key []byte) error) error
+}
+
+// Storage that can iterate over keys in bytewise (lexicographical) order
+type OrderedStorage interface {
+	Storage
+	// Iterate over keys in range [from, to) in ascending order. Nil from or to means unbounded range
+	KeysRange(from, to []byte, handler func(key []byte) error) error
+}
+
+// Storage that can atomically put value only if key does not exist (like HSETNX in REDIS)
+type AtomicStorage interface {
+	Storage
+	// Put value if key does not exist. Returns true if value was put
+	PutIfAbsent(key []byte, data []byte) (bool, error)
+}
+
+// Storage that can deliver notifications about keys between processes (like BLPOP in REDIS)
+type Signaller interface {
+	// Notify waiters of key. Notification is delivered at least to one waiter (if any)
+	Notify(key []byte) error
+	// Wait for notification of key. Returns context error if context is done before notification
+	Wait(ctx context.Context, key []byte) error
+}
+
 // Clear storage
 type Clearable interface {
 	// Clear all data in storage
@@ -72,6 +120,9 @@ type Dedup interface {
 	IsDuplicated(key []byte) (bool, error)
 	// Save key for future checks
 	Save(key []byte) error
+	// Atomically check and save key: returns true if key was already saved (key is not saved again).
+	// Atomicity between processes depends on implementation and backend storage
+	SaveIfAbsent(key []byte) (wasDuplicate bool, err error)
 }
 
 // Extract all keys from storage as-is
@@ -100,6 +151,63 @@ func AllKeysString(storage Storage) ([]string, error) {
 	return ans, err
 }
 
+// Iterate over keys with defined prefix. Uses PrefixedStorage if supported, otherwise filters all keys
+func KeysPrefix(storage Storage, prefix []byte, handler func(key []byte) error) error {
+	if prefixed, ok := storage.(PrefixedStorage); ok {
+		return prefixed.KeysPrefix(prefix, handler)
+	}
+	return storage.Keys(func(key []byte) error {
+		if !bytes.HasPrefix(key, prefix) {
+			return nil
+		}
+		return handler(key)
+	})
+}
+
+// Iterate over keys in range [from, to) in ascending order (nil from or to means unbounded range).
+// Uses OrderedStorage if supported, otherwise filters all keys and sorts them in memory
+func KeysRange(storage Storage, from, to []byte, handler func(key []byte) error) error {
+	if ordered, ok := storage.(OrderedStorage); ok {
+		return ordered.KeysRange(from, to, handler)
+	}
+	var keys [][]byte
+	err := storage.Keys(func(key []byte) error {
+		if InRange(key, from, to) {
+			cp := make([]byte, len(key))
+			copy(cp, key)
+			keys = append(keys, cp)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	for _, key := range keys {
+		err = handler(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Is key in range [from, to). Nil from or to means unbounded range
+func InRange(key, from, to []byte) bool {
+	return (from == nil || bytes.Compare(key, from) >= 0) && (to == nil || bytes.Compare(key, to) < 0)
+}
+
+// Get existent namespace without creating it if storage is ExistingNamespacedStorage, otherwise get or create
+// namespace (storage could create empty namespace)
+func ExistingNamespace(storage NamespacedStorage, name []byte) (Storage, error) {
+	if existing, ok := storage.(ExistingNamespacedStorage); ok {
+		return existing.ExistingNamespace(name)
+	}
+	return storage.Namespace(name)
+}
+
 // Extract all namespaces from storage as-is
 func AllNamespaces(storage NamespacedStorage) ([][]byte, error) {
 	if storage == nil {
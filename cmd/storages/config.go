@@ -12,7 +12,7 @@ type configCmd struct {
 }
 
 type configExample struct {
-	Type string `short:"t" long:"type" env:"TYPE" description:"Storage type for example" default:"redundant" choice:"simple" choice:"redundant" choice:"sharded"`
+	Type string `short:"t" long:"type" env:"TYPE" description:"Storage type for example" default:"redundant" choice:"simple" choice:"redundant" choice:"sharded" choice:"consistent"`
 }
 
 func (c *configExample) Execute(args []string) error {
@@ -28,6 +28,18 @@ func (c *configExample) Execute(args []string) error {
 				"key2forConfigurationForStorage",
 			},
 		}, "", " ")
+	case "consistent":
+		data, err = json.MarshalIndent(config2.Sharded{
+			Shards: []string{
+				"key1forConfigurationForStorage",
+				"key2forConfigurationForStorage",
+			},
+			Strategy: config2.StrategyConsistent,
+			Weights: map[string]int{
+				"key2forConfigurationForStorage": 2,
+			},
+			VirtualNodes: 128,
+		}, "", " ")
 	case "redundant":
 		rdr := config2.Redundant{
 			Read: config2.ReadStrategy{
@@ -37,6 +49,10 @@ func (c *configExample) Execute(args []string) error {
 				AtLeast: &config2.AtLeast{Num: 2},
 			},
 			Dedup: "key1forStorageForDeduplication",
+			Health: &config2.HealthCheck{
+				Interval: "10s",
+				Key:      "__health__",
+			},
 			Storages: []string{
 				"key2forConfigurationForStorage",
 				"key3forConfigurationForStorage",
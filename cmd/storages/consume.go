@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+type queueConsume struct {
+	Exec    string        `short:"e" long:"exec" env:"EXEC" description:"Shell command to process data (from STDIN)" required:"yes"`
+	Workers int           `short:"w" long:"workers" env:"WORKERS" description:"Number of concurrent workers" default:"1"`
+	Rate    float64       `short:"r" long:"rate" env:"RATE" description:"Maximum number of processed data per second (0 - unlimited)"`
+	Timeout time.Duration `short:"t" long:"timeout" env:"TIMEOUT" description:"Visibility timeout: data will be returned to queue if processing takes longer" default:"5m"`
+}
+
+// reliable queue with blocking reserve (see queues.Reliable)
+type waitingReliableQueue interface {
+	Reserve(timeout time.Duration) (uint64, []byte, error)
+	ReserveWait(ctx context.Context, timeout time.Duration) (uint64, []byte, error)
+	Ack(id uint64) error
+	Nack(id uint64) error
+}
+
+func (q *queueConsume) Execute(args []string) error {
+	reliable, db := config.getReliableQueue()
+	defer db.Close()
+	queue, ok := reliable.(waitingReliableQueue)
+	if !ok {
+		return errors.New("queue does not support waiting")
+	}
+	if q.Workers <= 0 {
+		q.Workers = 1
+	}
+
+	// first interrupt stops receiving new data, second one kills running commands
+	receiving, stopReceiving := context.WithCancel(context.Background())
+	running, kill := context.WithCancel(context.Background())
+	defer stopReceiving()
+	defer kill()
+	go func() {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt)
+		defer signal.Stop(c)
+		select {
+		case <-c:
+			log.Println("waiting for running commands, interrupt again to kill them")
+			stopReceiving()
+		case <-running.Done():
+			return
+		}
+		select {
+		case <-c:
+			kill()
+		case <-running.Done():
+		}
+	}()
+
+	var limit <-chan time.Time
+	if q.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / q.Rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+	wg.Add(q.Workers)
+	for i := 0; i < q.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			err := q.worker(receiving, running, queue, limit)
+			if err != nil {
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errLock.Unlock()
+				stopReceiving()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (q *queueConsume) worker(receiving, running context.Context, queue waitingReliableQueue, limit <-chan time.Time) error {
+	for {
+		if limit != nil {
+			select {
+			case <-limit:
+			case <-receiving.Done():
+				return nil
+			}
+		}
+		id, data, err := queue.ReserveWait(receiving, q.Timeout)
+		if err == context.Canceled {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "reserve data")
+		}
+		err = runWithInput(running, q.Exec, data)
+		if err != nil {
+			err = queue.Nack(id)
+		} else {
+			err = queue.Ack(id)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "complete %v", id)
+		}
+	}
+}
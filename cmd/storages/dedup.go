@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/dedup"
+	"os"
+	"time"
+)
+
+type dedupCmd struct {
+	Kind             string        `long:"kind" env:"KIND" description:"Deduplication method" default:"naive" choice:"naive" choice:"offloaded" choice:"windowed" choice:"bloom"`
+	MaxKeys          int           `long:"max-keys" env:"MAX_KEYS" description:"Maximum keys to keep after cleanup (naive)" default:"1000000"`
+	CleanFactor      int           `long:"clean-factor" env:"CLEAN_FACTOR" description:"Multiply factor of max keys that triggers cleanup (naive)" default:"2"`
+	Window           time.Duration `long:"window" env:"WINDOW" description:"Interval to remember keys (windowed)" default:"24h"`
+	Expected         int           `long:"expected" env:"EXPECTED" description:"Expected number of keys (bloom)" default:"1000000"`
+	FPRate           float64       `long:"fp-rate" env:"FP_RATE" description:"Acceptable false-positive rate (bloom)" default:"0.001"`
+	SnapshotKey      string        `long:"snapshot-key" env:"SNAPSHOT_KEY" description:"Key in storage for snapshot of filter (bloom)" default:"bloom"`
+	SnapshotInterval time.Duration `long:"snapshot-interval" env:"SNAPSHOT_INTERVAL" description:"Interval between snapshots of filter (bloom)" default:"1m"`
+	Check            dedupCheck    `command:"check" description:"atomically check and save keys: prints duplicated keys, exit code 1 if all keys duplicated"`
+	Serve            dedupServe    `command:"serve" alias:"rest" description:"expose deduplication over REST interface"`
+}
+
+type dedupCheck struct {
+	Args struct {
+		Keys []string `description:"keys to check and save" positional-arg-name:"keys" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (d *dedupCheck) Execute(args []string) error {
+	dd, closer, err := config.Dedup.open()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	var duplicates int
+	for _, key := range d.Args.Keys {
+		duplicated, err := dd.SaveIfAbsent([]byte(key))
+		if err != nil {
+			return errors.Wrapf(err, "check %v", key)
+		}
+		if duplicated {
+			fmt.Println(key)
+			duplicates++
+		}
+	}
+	if duplicates == len(d.Args.Keys) {
+		closer()
+		os.Exit(1)
+	}
+	return nil
+}
+
+type dedupServe struct {
+	queueServe
+}
+
+func (d *dedupServe) Execute(args []string) error {
+	dd, closer, err := config.Dedup.open()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	return d.serve("REST deduplication server", dedup.NewServer(dd))
+}
+
+// open deduplication by kind; closer saves state (if needed) and closes storage
+func (d *dedupCmd) open() (storages.Dedup, func(), error) {
+	db := config.Storage()
+	closeDB := func() { db.Close() }
+	switch d.Kind {
+	case "offloaded":
+		return dedup.Offloaded(db), closeDB, nil
+	case "windowed":
+		ns, ok := db.(storages.NamespacedStorage)
+		if !ok {
+			db.Close()
+			return nil, nil, errors.New("storage does not support namespaces")
+		}
+		wd, err := dedup.Windowed(ns, d.Window)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return wd, closeDB, nil
+	case "bloom":
+		bl := dedup.Bloom(d.Expected, d.FPRate)
+		err := bl.Persist(db, []byte(d.SnapshotKey), d.SnapshotInterval)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return bl, func() {
+			err := bl.Close()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "failed save snapshot:", err)
+			}
+			db.Close()
+		}, nil
+	default:
+		nv, err := dedup.NewNaive(db, d.MaxKeys, d.CleanFactor)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return nv, closeDB, nil
+	}
+}
@@ -47,6 +47,9 @@ type Config struct {
 	Serve     restServe     `command:"serve" alias:"rest" description:"expose storage over REST interface"`
 	Config    configCmd     `command:"config" alias:"cfg" description:"operations on configuration"`
 	Queue     queueCmd      `command:"queue" alias:"q" description:"access to storage by naive queue interface"`
+	Reshard   reshardCmd    `command:"reshard" description:"move keys between sharded configurations"`
+	Topic     topicCmd      `command:"topic" description:"publish-subscribe over storage"`
+	Dedup     dedupCmd      `command:"dedup" description:"deduplication of keys over storage"`
 }
 
 func (cfg *Config) getSource() storages.Storage {
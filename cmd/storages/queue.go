@@ -3,9 +3,14 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/reddec/storages"
 	"github.com/reddec/storages/queues"
+	"github.com/reddec/storages/std"
+	stor_utils "github.com/reddec/storages/utils"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -17,16 +22,218 @@ import (
 const statusNoData = 127
 
 type queueCmd struct {
-	Put     queuePut     `command:"put" alias:"push" alias:"append" description:"put data to the queue"`
-	Peek    queuePeek    `command:"peek" description:"get oldest data from queue but not remove"`
-	Get     queueGet     `command:"get" alias:"pop" description:"get oldest data from queue and remove it"`
-	Discard queueDiscard `command:"discard" description:"remove oldest data from queue (like silent get)"`
-	Serve   queueServe   `command:"serve" alias:"rest" description:"expose queue over REST interface"`
+	MaxAttempts int          `long:"max-attempts" env:"MAX_ATTEMPTS" description:"Maximum number of deliveries for reserved data before moving to dead-letter queue (0 - unlimited)"`
+	DeadLetter  string       `long:"dead-letter" env:"DEAD_LETTER" description:"Storage URL for dead-letter queue. If not set - namespace dead-letter in the queue storage"`
+	Put         queuePut     `command:"put" alias:"push" alias:"append" description:"put data to the queue"`
+	Peek        queuePeek    `command:"peek" description:"get oldest data from queue but not remove"`
+	Get         queueGet     `command:"get" alias:"pop" description:"get oldest data from queue and remove it"`
+	Discard     queueDiscard `command:"discard" description:"remove oldest data from queue (like silent get)"`
+	Reserve     queueReserve `command:"reserve" description:"reserve oldest data for processing: prints ID line and then data"`
+	Ack         queueAck     `command:"ack" description:"acknowledge reserved data as processed"`
+	Nack        queueNack    `command:"nack" description:"return reserved data to the queue"`
+	Serve       queueServe   `command:"serve" alias:"rest" description:"expose queue over REST interface"`
+	DLQ         queueDLQ     `command:"dlq" alias:"dead-letter" description:"operations on dead-letter queue"`
+	Stats       queueStats   `command:"stats" description:"show statistics of queue"`
+	List        queueList    `command:"list" alias:"ls" description:"list data in queue without removing"`
+	Purge       queuePurge   `command:"purge" description:"remove all data from queue"`
+	Consume     queueConsume `command:"consume" alias:"worker" description:"process data by shell command in concurrent workers"`
+	Migrate     queueMigrate `command:"migrate" description:"move data between legacy (simple) and naive queue layouts"`
+}
+
+type queueMigrate struct {
+	Layout string `short:"l" long:"layout" env:"LAYOUT" description:"Target layout" choice:"naive" choice:"legacy" required:"yes"`
+	Target string `short:"t" long:"target" env:"TARGET" description:"Target storage URL. If not set - in-place migration"`
+}
+
+func (q queueMigrate) Execute(args []string) error {
+	db := config.Storage()
+	defer db.Close()
+	var target = db
+	if q.Target != "" {
+		stor, err := std.Create(q.Target)
+		if err != nil {
+			return errors.Wrap(err, "open target storage")
+		}
+		defer stor.Close()
+		target = stor
+	}
+	var moved int
+	var err error
+	switch q.Layout {
+	case "naive":
+		moved, err = queues.MigrateToNaive(db, target)
+	case "legacy":
+		moved, err = queues.MigrateToLegacy(db, target)
+	}
+	log.Println("moved", moved, "items")
+	return err
+}
+
+type queueStats struct {
+	JSON bool `long:"json" env:"JSON" description:"Print statistics as JSON object"`
+}
+
+func (q queueStats) Execute(args []string) error {
+	queue, db := config.getBrowsableQueue()
+	defer db.Close()
+	stats := queues.Stats{Length: queue.Len()}
+	if q.JSON {
+		return json.NewEncoder(os.Stdout).Encode(stats)
+	}
+	fmt.Println("length:", stats.Length)
+	return nil
+}
+
+type queueList struct {
+	From  uint64 `short:"f" long:"from" env:"FROM" description:"Start from ID"`
+	Limit int    `short:"n" long:"limit" env:"LIMIT" description:"Maximum number of data to show (0 - all)"`
+	JSON  bool   `long:"json" env:"JSON" description:"Print each data as JSON object {id, data (base64)} per line"`
+}
+
+func (q queueList) Execute(args []string) error {
+	queue, db := config.getBrowsableQueue()
+	defer db.Close()
+	return listQueue(os.Stdout, queue, q.From, 0, q.Limit, q.JSON)
+}
+
+// print records of queue starting from id, skipping offset records and showing at most limit records (0 - all)
+func listQueue(out io.Writer, queue storages.BrowsableQueue, from uint64, offset, limit int, asJSON bool) error {
+	var skipped, shown int
+	var stop = errors.New("stop")
+	enc := json.NewEncoder(out)
+	err := queue.Range(from, func(id uint64, data []byte) error {
+		if skipped < offset {
+			skipped++
+			return nil
+		}
+		if limit > 0 && shown >= limit {
+			return stop
+		}
+		shown++
+		if asJSON {
+			return enc.Encode(queues.Message{ID: id, Data: data})
+		}
+		_, err := fmt.Fprintf(out, "%d\t%s\n", id, data)
+		return err
+	})
+	if err == stop {
+		return nil
+	}
+	return err
+}
+
+type queuePurge struct{}
+
+func (q queuePurge) Execute(args []string) error {
+	queue, db := config.getBrowsableQueue()
+	defer db.Close()
+	return queue.Purge()
+}
+
+func (cfg Config) getBrowsableQueue() (storages.BrowsableQueue, storages.Storage) {
+	db := cfg.Storage()
+	queue, err := queues.NaiveQueue(db)
+	if err != nil {
+		db.Close()
+		log.Fatal("open queue:", err)
+	}
+	return queue, db
+}
+
+type queueDLQ struct {
+	Peek    dlqPeek    `command:"peek" description:"get oldest data from dead-letter queue but not remove"`
+	List    dlqList    `command:"list" alias:"ls" description:"list data in dead-letter queue without removing"`
+	Redrive dlqRedrive `command:"redrive" description:"move data from dead-letter queue back to the queue"`
+}
+
+type dlqPeek struct{}
+
+func (d dlqPeek) Execute(args []string) error {
+	db := config.Storage()
+	defer db.Close()
+	dlq, dlqStorage, err := config.Queue.openDeadLetter(db)
+	if err != nil {
+		return err
+	}
+	defer dlqStorage.Close()
+	data, err := dlq.Peek()
+	if err == os.ErrNotExist {
+		dlqStorage.Close()
+		db.Close()
+		os.Exit(statusNoData)
+	} else if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+type dlqList struct {
+	Offset int  `short:"o" long:"offset" env:"OFFSET" description:"Number of data to skip"`
+	Limit  int  `short:"n" long:"limit" env:"LIMIT" description:"Maximum number of data to show (0 - all)"`
+	JSON   bool `long:"json" env:"JSON" description:"Print each data as JSON object {id, data (base64)} per line"`
+}
+
+func (d dlqList) Execute(args []string) error {
+	db := config.Storage()
+	defer db.Close()
+	dlq, dlqStorage, err := config.Queue.openDeadLetter(db)
+	if err != nil {
+		return err
+	}
+	defer dlqStorage.Close()
+	return listQueue(os.Stdout, dlq, 0, d.Offset, d.Limit, d.JSON)
+}
+
+type dlqRedrive struct {
+	Limit int `short:"n" long:"limit" env:"LIMIT" description:"Maximum number of data to move (0 - all)"`
+}
+
+func (d dlqRedrive) Execute(args []string) error {
+	queue, db := config.getQueue()
+	defer db.Close()
+	dlq, dlqStorage, err := config.Queue.openDeadLetter(db)
+	if err != nil {
+		return err
+	}
+	defer dlqStorage.Close()
+	moved, err := queues.Redrive(dlq, queue, d.Limit)
+	log.Println("moved", moved, "items")
+	return err
+}
+
+// open dead-letter queue by URL or in namespace of the queue storage
+func (qc *queueCmd) openDeadLetter(db storages.Storage) (storages.BrowsableQueue, storages.Storage, error) {
+	var dlqStorage storages.Storage
+	if qc.DeadLetter != "" {
+		stor, err := std.Create(qc.DeadLetter)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "open dead-letter storage")
+		}
+		dlqStorage = stor
+	} else {
+		ns, ok := db.(storages.NamespacedStorage)
+		if !ok {
+			return nil, nil, errors.New("queue storage does not support namespaces - define dead-letter URL")
+		}
+		stor, err := ns.Namespace([]byte("dead-letter"))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "open dead-letter namespace")
+		}
+		dlqStorage = stor
+	}
+	dlq, err := queues.NaiveQueue(dlqStorage)
+	if err != nil {
+		dlqStorage.Close()
+		return nil, nil, errors.Wrap(err, "open dead-letter queue")
+	}
+	return dlq, dlqStorage, nil
 }
 
 type queuePut struct {
-	Line bool `short:"l" long:"line" env:"LINE" description:"Line mode for STDIN value - each line is new value"`
-	Args struct {
+	Line  bool `short:"l" long:"line" env:"LINE" description:"Line mode for STDIN value - each line is new value"`
+	Batch int  `short:"b" long:"batch" env:"BATCH" description:"Maximum number of values put at once in line mode" default:"100"`
+	Args  struct {
 		Values []string `description:"values to put to the queue, if not set - STDIN lines used" positional-arg-name:"values"`
 	} `positional-args:"yes"`
 }
@@ -35,25 +242,32 @@ func (q *queuePut) Execute(args []string) error {
 	queue, db := config.getQueue()
 	defer db.Close()
 
-	for _, value := range q.Args.Values {
-		err := queue.Put([]byte(value))
-		if err != nil {
-			return errors.Wrap(err, "put data to queue")
-		}
-	}
 	if len(q.Args.Values) > 0 {
-		return nil
+		var items = make([][]byte, len(q.Args.Values))
+		for i, value := range q.Args.Values {
+			items[i] = []byte(value)
+		}
+		return errors.Wrap(queues.PutBatch(queue, items), "put data to queue")
 	}
 
 	if q.Line {
+		var batch [][]byte
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
-			err := queue.Put(scanner.Bytes())
+			batch = append(batch, append([]byte{}, scanner.Bytes()...))
+			if len(batch) < q.Batch {
+				continue
+			}
+			err := queues.PutBatch(queue, batch)
 			if err != nil {
 				return errors.Wrap(err, "put data to queue")
 			}
+			batch = nil
 		}
-		return nil
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.Wrap(queues.PutBatch(queue, batch), "put data to queue")
 	}
 	data, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
@@ -67,13 +281,15 @@ func (q *queuePut) Execute(args []string) error {
 }
 
 type queueGet struct {
+	Wait    bool          `short:"w" long:"wait" env:"WAIT" description:"Wait for data if queue is empty"`
+	Timeout time.Duration `long:"timeout" env:"TIMEOUT" description:"Maximum waiting time (0 - infinity)"`
 }
 
 func (q *queueGet) Execute(args []string) error {
 	queue, db := config.getQueue()
 	defer db.Close()
-	data, err := queue.Get()
-	if err == os.ErrNotExist {
+	data, err := q.get(queue)
+	if err == os.ErrNotExist || err == context.DeadlineExceeded {
 		db.Close()
 		os.Exit(statusNoData)
 	} else if err != nil {
@@ -84,6 +300,29 @@ func (q *queueGet) Execute(args []string) error {
 	return err
 }
 
+func (q *queueGet) get(queue storages.Queue) ([]byte, error) {
+	if !q.Wait {
+		return queue.Get()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if q.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		defer signal.Stop(c)
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return queues.GetWait(ctx, queue)
+}
+
 type queuePeek struct {
 }
 
@@ -115,6 +354,86 @@ func (q queueDiscard) Execute(args []string) error {
 	return err
 }
 
+type queueReserve struct {
+	Timeout time.Duration `short:"t" long:"timeout" env:"TIMEOUT" description:"Visibility timeout: data will be returned to queue if not acknowledged" default:"30s"`
+}
+
+func (q *queueReserve) Execute(args []string) error {
+	queue, db := config.getReliableQueue()
+	defer db.Close()
+	id, data, err := queue.Reserve(q.Timeout)
+	if err == os.ErrNotExist {
+		db.Close()
+		os.Exit(statusNoData)
+	} else if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, id)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	os.Stdout.Close()
+	return err
+}
+
+type queueAck struct {
+	Args struct {
+		IDs []uint64 `description:"IDs of reserved data" positional-arg-name:"id" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (q *queueAck) Execute(args []string) error {
+	queue, db := config.getReliableQueue()
+	defer db.Close()
+	for _, id := range q.Args.IDs {
+		err := queue.Ack(id)
+		if err != nil {
+			return errors.Wrapf(err, "ack %v", id)
+		}
+	}
+	return nil
+}
+
+type queueNack struct {
+	Args struct {
+		IDs []uint64 `description:"IDs of reserved data" positional-arg-name:"id" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (q *queueNack) Execute(args []string) error {
+	queue, db := config.getReliableQueue()
+	defer db.Close()
+	for _, id := range q.Args.IDs {
+		err := queue.Nack(id)
+		if err != nil {
+			return errors.Wrapf(err, "nack %v", id)
+		}
+	}
+	return nil
+}
+
+func (cfg Config) getReliableQueue() (storages.ReliableQueue, storages.Storage) {
+	db := cfg.Storage()
+	queue, err := queues.Reliable(db)
+	if err != nil {
+		db.Close()
+		log.Fatal("open queue:", err)
+	}
+	if cfg.Queue.MaxAttempts <= 0 {
+		return queue, db
+	}
+	dlq, dlqStorage, err := cfg.Queue.openDeadLetter(db)
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	queue.WithDeadLetter(cfg.Queue.MaxAttempts, dlq)
+	return queue, stor_utils.WithCloseHook(db, func() {
+		dlqStorage.Close()
+	})
+}
+
 func (cfg Config) getQueue() (storages.Queue, storages.Storage) {
 	db := cfg.Storage()
 	queue, err := queues.NaiveQueue(db)
@@ -134,12 +453,15 @@ type queueServe struct {
 }
 
 func (qs *queueServe) Execute(args []string) error {
-	queue, db := config.getQueue()
+	queue, db := config.getReliableQueue()
 	defer db.Close()
+	return qs.serve("REST queue server", queues.NewServer(queue))
+}
 
+func (qs *queueServe) serve(name string, handler http.Handler) error {
 	server := http.Server{
 		Addr:    qs.Bind,
-		Handler: queues.NewServer(queue),
+		Handler: handler,
 	}
 
 	go func() {
@@ -150,7 +472,7 @@ func (qs *queueServe) Execute(args []string) error {
 		defer cancel()
 		server.Shutdown(ctx)
 	}()
-	log.Println("REST queue server is on", qs.Bind)
+	log.Println(name, "is on", qs.Bind)
 	if qs.TLS {
 		return server.ListenAndServeTLS(qs.CertFile, qs.KeyFile)
 	}
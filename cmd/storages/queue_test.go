@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"github.com/reddec/storages/queues"
+	"github.com/reddec/storages/std/memstorage"
+	"testing"
+)
+
+func TestListQueue(t *testing.T) {
+	queue, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		if err := queue.Put([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name          string
+		offset, limit int
+		expected      string
+	}{
+		{"all", 0, 0, "1\ta\n2\tb\n3\tc\n4\td\n5\te\n"},
+		{"limit", 0, 2, "1\ta\n2\tb\n"},
+		{"offset", 3, 0, "4\td\n5\te\n"},
+		{"page", 1, 2, "2\tb\n3\tc\n"},
+		{"beyond", 10, 2, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := listQueue(&out, queue, 0, c.offset, c.limit, false); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, out.String())
+			}
+		})
+	}
+}
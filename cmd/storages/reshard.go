@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	storageconfig "github.com/reddec/storages/config"
+	"github.com/reddec/storages/sharded"
+	"github.com/reddec/storages/std"
+	"log"
+	"os"
+	"os/signal"
+)
+
+type reshardCmd struct {
+	Checkpoint string `long:"checkpoint" env:"CHECKPOINT" description:"Storage URL for migration progress" default:"bbolt://reshard"`
+	Batch      int    `long:"batch" env:"BATCH" description:"Maximum number of keys moved in one batch" default:"1024"`
+	Reset      bool   `long:"reset" env:"RESET" description:"Start migration from the beginning"`
+	Args       struct {
+		From string `description:"key in storage where old sharded configuration defined" positional-arg-name:"from" required:"yes"`
+		To   string `description:"key in storage where new sharded configuration defined" positional-arg-name:"to" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (r *reshardCmd) Execute(args []string) error {
+	src := config.getSource()
+	migrationID, err := configsHash(src, r.Args.From, r.Args.To)
+	if err != nil {
+		src.Close()
+		return errors.Wrap(err, "read sharding configuration")
+	}
+	pools, err := storageconfig.ParsePoolsJSON(src, []byte(r.Args.From), []byte(r.Args.To))
+	src.Close()
+	if err != nil {
+		return errors.Wrap(err, "parse sharding configuration")
+	}
+	oldPool, newPool := pools[0], pools[1]
+	// pools share storages referenced by both configurations
+	defer sharded.ClosePools(oldPool, newPool)
+
+	checkpoint, err := std.Create(r.Checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "open checkpoint storage")
+	}
+	defer checkpoint.Close()
+
+	rebalancer := sharded.NewRebalancer(oldPool, newPool, checkpoint).WithCheckpointID(migrationID).WithBatchSize(r.Batch).WithProgress(func(shard int, moved int64) {
+		log.Println("shard", shard, "moved", moved, "keys")
+	})
+	if r.Reset {
+		err = rebalancer.Reset()
+		if err != nil {
+			return errors.Wrap(err, "reset checkpoint")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		log.Println("stopping migration...")
+		cancel()
+	}()
+
+	err = rebalancer.Run(ctx)
+	if err == context.Canceled {
+		log.Println("migration interrupted, progress saved")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("migration complete")
+	return nil
+}
+
+// hash of old and new configurations: checkpoint of migration is valid only for the same configurations
+func configsHash(src storages.Storage, keys ...string) (string, error) {
+	hash := sha256.New()
+	for _, key := range keys {
+		data, err := src.Get([]byte(key))
+		if err != nil {
+			return "", errors.Wrapf(err, "get %v", key)
+		}
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(data)))
+		hash.Write(size[:])
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/pubsub"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+type topicCmd struct {
+	Publish     topicPublish     `command:"publish" alias:"pub" description:"publish data to all subscriptions"`
+	Subscribe   topicSubscribe   `command:"subscribe" alias:"sub" description:"create subscription and receive data"`
+	Unsubscribe topicUnsubscribe `command:"unsubscribe" alias:"unsub" description:"remove subscription and its data"`
+	List        topicList        `command:"list" alias:"ls" description:"list subscriptions"`
+	Serve       topicServe       `command:"serve" alias:"rest" description:"expose topic over REST interface"`
+}
+
+type topicPublish struct {
+	Line bool `short:"l" long:"line" env:"LINE" description:"Line mode for STDIN value - each line is new value"`
+	Args struct {
+		Values []string `description:"values to publish, if not set - STDIN used" positional-arg-name:"values"`
+	} `positional-args:"yes"`
+}
+
+func (t *topicPublish) Execute(args []string) error {
+	db := config.getTopicStorage()
+	defer db.Close()
+	topic, err := pubsub.NewTopic(db)
+	if err != nil {
+		return errors.Wrap(err, "open topic")
+	}
+	defer topic.Close()
+	for _, value := range t.Args.Values {
+		err := topic.Publish([]byte(value))
+		if err != nil {
+			return err
+		}
+	}
+	if len(t.Args.Values) > 0 {
+		return nil
+	}
+	if t.Line {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			err := topic.Publish(scanner.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	return topic.Publish(data)
+}
+
+type topicSubscribe struct {
+	Exec    string        `short:"e" long:"exec" env:"EXEC" description:"Shell command to process data (from STDIN). Data is acknowledged if command succeeded, otherwise delivered again after timeout. If not set - data printed to STDOUT line by line"`
+	Timeout time.Duration `short:"t" long:"timeout" env:"TIMEOUT" description:"Visibility timeout: not acknowledged data will be delivered again" default:"30s"`
+	Args    struct {
+		Name string `description:"subscription name" positional-arg-name:"name" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (t *topicSubscribe) Execute(args []string) error {
+	db := config.getTopicStorage()
+	defer db.Close()
+	topic, err := pubsub.NewTopic(db)
+	if err != nil {
+		return errors.Wrap(err, "open topic")
+	}
+	defer topic.Close()
+	sub, err := topic.Subscribe(t.Args.Name)
+	if err != nil {
+		return errors.Wrap(err, "subscribe")
+	}
+	sub.WithVisibilityTimeout(t.Timeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		defer signal.Stop(c)
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = sub.Listen(ctx, t.process)
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+func (t *topicSubscribe) process(data []byte) error {
+	if t.Exec == "" {
+		_, err := fmt.Fprintf(os.Stdout, "%s\n", data)
+		return err
+	}
+	return runWithInput(context.Background(), t.Exec, data)
+}
+
+// run shell command with data as STDIN. Output of command is forwarded to the current STDOUT and STDERR
+func runWithInput(ctx context.Context, command string, data []byte) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	_, err = stdin.Write(data)
+	stdin.Close()
+	if err != nil {
+		log.Println("write data to command:", err)
+	}
+	err = cmd.Wait()
+	if err != nil {
+		log.Println("command failed:", err)
+	}
+	return err
+}
+
+type topicUnsubscribe struct {
+	Args struct {
+		Names []string `description:"subscriptions names" positional-arg-name:"name" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (t *topicUnsubscribe) Execute(args []string) error {
+	db := config.getTopicStorage()
+	defer db.Close()
+	topic, err := pubsub.NewTopic(db)
+	if err != nil {
+		return errors.Wrap(err, "open topic")
+	}
+	defer topic.Close()
+	for _, name := range t.Args.Names {
+		err := topic.Unsubscribe(name)
+		if err != nil {
+			return errors.Wrapf(err, "unsubscribe %v", name)
+		}
+	}
+	return nil
+}
+
+type topicList struct {
+	JSON bool `long:"json" env:"JSON" description:"Print names as JSON array"`
+}
+
+func (t *topicList) Execute(args []string) error {
+	db := config.getTopicStorage()
+	defer db.Close()
+	topic, err := pubsub.NewTopic(db)
+	if err != nil {
+		return errors.Wrap(err, "open topic")
+	}
+	defer topic.Close()
+	names := topic.Subscriptions()
+	if t.JSON {
+		return json.NewEncoder(os.Stdout).Encode(names)
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+type topicServe struct {
+	queueServe
+}
+
+func (t *topicServe) Execute(args []string) error {
+	db := config.getTopicStorage()
+	defer db.Close()
+	topic, err := pubsub.NewTopic(db)
+	if err != nil {
+		return errors.Wrap(err, "open topic")
+	}
+	defer topic.Close()
+	return t.serve("REST topic server", pubsub.NewServer(topic))
+}
+
+// storage for topic: should support namespaces for subscriptions
+func (cfg Config) getTopicStorage() storages.NamespacedStorage {
+	db := cfg.Storage()
+	ns, ok := db.(storages.NamespacedStorage)
+	if !ok {
+		db.Close()
+		log.Fatal("storage does not support namespaces")
+	}
+	return ns
+}
@@ -52,20 +52,11 @@ func getStorage(key []byte, storage storages.Storage, decoderFunc DecoderFunc, l
 		loaded[string(key)] = stor
 		return stor, nil
 	case "sharded":
-		var cfg Sharded
-		err = decoderFunc(data, &cfg)
+		pool, err := getPool(key, data, storage, decoderFunc, loaded)
 		if err != nil {
 			return nil, err
 		}
-		var shards []storages.Storage
-		for _, shardId := range cfg.Shards {
-			shard, err := getStorage([]byte(shardId), storage, decoderFunc, loaded)
-			if err != nil {
-				return nil, errors.Wrapf(err, "get shard %v", shardId)
-			}
-			shards = append(shards, shard)
-		}
-		stor := storages.Sharded(sharded.NewHashedArray(shards))
+		stor := storages.Sharded(pool)
 		loaded[string(key)] = stor
 		return stor, nil
 	case "redundant":
@@ -91,9 +82,83 @@ func getStorage(key []byte, storage storages.Storage, decoderFunc DecoderFunc, l
 		} else {
 			dedupStorage = memstorage.New()
 		}
-		return storages.Redundant(redundant.Write.GetStrategy(backs), redundant.Read.GetStrategy(backs), dedup.Offloaded(dedupStorage), backs...), nil
+		stor := storages.Redundant(redundant.Write.GetStrategy(backs), redundant.Read.GetStrategy(backs), dedup.Offloaded(dedupStorage), backs...)
+		if redundant.Health != nil {
+			interval, check, err := redundant.Health.GetCheck()
+			if err != nil {
+				return nil, errors.Wrapf(err, "health check of %v", string(key))
+			}
+			stor.WithHealthCheck(interval, check)
+		}
+		return stor, nil
 	default:
 		return nil, errors.Errorf("unknown storage kind '%v' in %v", kind.Kind, string(key))
 	}
 
 }
+
+// Parse sharding pools from configurations defined in entry cells (should be sharded kind). With standard JSON decoder.
+// Storages referenced by several pools will be initialized once and shared between pools
+func ParsePoolsJSON(storage storages.Storage, entryKeys ...[]byte) ([]storages.ShardPool, error) {
+	return ParsePoolsWithDecoder(storage, json.Unmarshal, entryKeys...)
+}
+
+// Parse sharding pools from configurations defined in entry cells (should be sharded kind). With custom decoder.
+// Storages referenced by several pools will be initialized once and shared between pools
+func ParsePoolsWithDecoder(storage storages.Storage, decoderFunc DecoderFunc, entryKeys ...[]byte) ([]storages.ShardPool, error) {
+	var loadedStorages = map[string]storages.Storage{}
+	var pools []storages.ShardPool
+	for _, entryKey := range entryKeys {
+		data, err := storage.Get(entryKey)
+		if err != nil {
+			return nil, err
+		}
+		var kind Kind
+		err = decoderFunc(data, &kind)
+		if err != nil {
+			return nil, err
+		}
+		if kind.Kind != "sharded" {
+			return nil, errors.Errorf("storage kind '%v' in %v is not sharded", kind.Kind, string(entryKey))
+		}
+		pool, err := getPool(entryKey, data, storage, decoderFunc, loadedStorages)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func getPool(key []byte, data []byte, storage storages.Storage, decoderFunc DecoderFunc, loaded map[string]storages.Storage) (storages.ShardPool, error) {
+	var cfg Sharded
+	err := decoderFunc(data, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	var shards []storages.Storage
+	for _, shardId := range cfg.Shards {
+		shard, err := getStorage([]byte(shardId), storage, decoderFunc, loaded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get shard %v", shardId)
+		}
+		shards = append(shards, shard)
+	}
+	var pool storages.ShardPool
+	switch cfg.Strategy {
+	case "", StrategyHashed:
+		pool = sharded.NewHashedArray(shards)
+	case StrategyConsistent:
+		consistent := sharded.NewConsistent(cfg.VirtualNodes)
+		for i, shardId := range cfg.Shards {
+			err = consistent.Add(shardId, shards[i], cfg.Weights[shardId])
+			if err != nil {
+				return nil, errors.Wrapf(err, "add shard %v", shardId)
+			}
+		}
+		pool = consistent
+	default:
+		return nil, errors.Errorf("unknown sharding strategy '%v' in %v", cfg.Strategy, string(key))
+	}
+	return pool, nil
+}
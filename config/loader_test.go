@@ -56,3 +56,26 @@ func setConfig(stor storages.Storage, t *testing.T, key string, config interface
 		t.Fatal(err)
 	}
 }
+
+func TestParseJSON_Consistent(t *testing.T) {
+	var stor = memstorage.New()
+	setConfig(stor, t, "main", Sharded{
+		Shards:   []string{"data1", "data2"},
+		Strategy: StrategyConsistent,
+		Weights:  map[string]int{"data2": 2},
+	})
+	setConfig(stor, t, "data1", Simple{URL: "memory://"})
+	setConfig(stor, t, "data2", Simple{URL: "memory://"})
+
+	root, err := ParseJSON([]byte("main"), stor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if err := root.Put([]byte("alice"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := root.Get([]byte("alice")); err != nil || string(v) != "1" {
+		t.Fatal("get alice:", err)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/reddec/storages"
+	"time"
 )
 
 // Kind of storage: sharded, simple or redundant
@@ -19,19 +20,56 @@ type Sharded struct {
 	// names of underlying storages
 	// that will be initialized and used as shards
 	Shards []string `json:"shards" yaml:"shards" xml:"shards"`
+	// distribution strategy: hashed (default) or consistent
+	Strategy string `json:"strategy,omitempty" yaml:"strategy,omitempty" xml:"strategy,omitempty"`
+	// relative weights of shards by name, only for consistent strategy (default 1)
+	Weights map[string]int `json:"weights,omitempty" yaml:"weights,omitempty" xml:"weights,omitempty"`
+	// number of virtual nodes per shard, only for consistent strategy (default sharded.DefaultVirtualNodes)
+	VirtualNodes int `json:"virtual_nodes,omitempty" yaml:"virtual_nodes,omitempty" xml:"virtual_nodes,omitempty"`
 }
 
+// Names of sharding strategies
+const (
+	StrategyHashed     = "hashed"
+	StrategyConsistent = "consistent"
+)
+
 // Redundant storage config
 type Redundant struct {
 	Read  ReadStrategy  `json:"read" yaml:"read" xml:"read"`    // how to read data
 	Write WriteStrategy `json:"write" yaml:"write" xml:"write"` // how to write data
 	// optional storage used for deduplication during keys iteration
 	Dedup string `json:"dedup" yaml:"dedup" xml:"dedup"`
+	// optional health checking of underlying storages
+	Health *HealthCheck `json:"health,omitempty" yaml:"health,omitempty" xml:"health,omitempty"`
 	// names of underlying storages
 	// that will be initialized and used for distribution
 	Storages []string `json:"storages" yaml:"storages" xml:"storages"`
 }
 
+// Health checking config for redundant storage
+type HealthCheck struct {
+	Interval string `json:"interval" yaml:"interval" xml:"interval"` // interval between checks in Go duration format (default 10s)
+	Key      string `json:"key" yaml:"key" xml:"key"`                // sentinel key to get (default __health__)
+}
+
+// Initialize health checking interval and function
+func (hc HealthCheck) GetCheck() (time.Duration, storages.HealthCheck, error) {
+	var interval = 10 * time.Second
+	if hc.Interval != "" {
+		v, err := time.ParseDuration(hc.Interval)
+		if err != nil {
+			return 0, nil, err
+		}
+		interval = v
+	}
+	var key = hc.Key
+	if key == "" {
+		key = "__health__"
+	}
+	return interval, storages.SentinelCheck([]byte(key)), nil
+}
+
 // Read strategy config for redundant storage
 type ReadStrategy struct {
 	// Iterate over storages until first value returned without error
@@ -0,0 +1,64 @@
+package dedup
+
+import (
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrent workers should process each key exactly once
+func TestSaveIfAbsent(t *testing.T) {
+	naive, err := NewNaive(memstorage.New(), 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	windowed, err := Windowed(memstorage.New(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		dedup storages.Dedup
+	}{
+		{"naive", naive},
+		{"offloaded", Offloaded(memstorage.New())},
+		{"windowed", windowed},
+		{"bloom", Bloom(1000, 0.001)},
+		{"rotating", RotatingBloom(1000, 0.001, 2)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const workers = 8
+			const keys = 100
+			var processed int64
+			var wg sync.WaitGroup
+			wg.Add(workers)
+			for w := 0; w < workers; w++ {
+				go func() {
+					defer wg.Done()
+					for i := 0; i < keys; i++ {
+						duplicated, err := tc.dedup.SaveIfAbsent([]byte("key-" + strconv.Itoa(i)))
+						if err != nil {
+							t.Error("failed check and save:", err)
+							return
+						}
+						if !duplicated {
+							atomic.AddInt64(&processed, 1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			if processed != keys {
+				t.Error("each key should be processed once, processed", processed, "of", keys)
+			}
+			if dup, err := tc.dedup.IsDuplicated([]byte("key-0")); err != nil || !dup {
+				t.Error("saved key should be marked as duplicated:", err)
+			}
+		})
+	}
+}
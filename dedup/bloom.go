@@ -0,0 +1,440 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"hash/fnv"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bloom filter based deduplication: keeps only bitset in memory, so memory usage does not depend on key size.
+// Bitset size and number of hash functions are calculated from expected number of items and acceptable false-positive
+// rate. Keys are never reported as not duplicated after Save, but not saved keys could be reported as duplicated
+// with fpRate probability (grows when number of saved keys is greater than expectedItems). See RotatingBloom
+// to bound false positives for infinite streams.
+//
+// Filter could be persisted to storage by Persist.
+func Bloom(expectedItems int, fpRate float64) *bloom {
+	return &bloom{
+		filter: newFilter(expectedItems, fpRate),
+	}
+}
+
+type bloom struct {
+	lock     sync.RWMutex
+	filter   *filter
+	snapshot *snapshot
+}
+
+func (bl *bloom) IsDuplicated(key []byte) (bool, error) {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+	return bl.filter.test(key), nil
+}
+
+func (bl *bloom) Save(key []byte) error {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	bl.filter.add(key)
+	bl.markDirty()
+	return nil
+}
+
+// Check and save key atomically (for the instance)
+func (bl *bloom) SaveIfAbsent(key []byte) (bool, error) {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	if bl.filter.test(key) {
+		return true, nil
+	}
+	bl.filter.add(key)
+	bl.markDirty()
+	return false, nil
+}
+
+// Remove all saved keys
+func (bl *bloom) Clear() error {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	bl.filter.reset()
+	bl.markDirty()
+	return nil
+}
+
+// Number of saved keys (including duplicates)
+func (bl *bloom) Count() int {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+	return int(bl.filter.count)
+}
+
+// Load bitset snapshot from storage key (if exists) and save snapshot every interval if filter changed.
+// Snapshot parameters (bitset size and number of hash functions) should be equal to current parameters.
+// Final snapshot is saved by Close. Should be called once before usage.
+func (bl *bloom) Persist(storage storages.KV, key []byte, interval time.Duration) error {
+	data, err := storage.Get(key)
+	if err == nil {
+		err = bl.filter.decode(bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrap(err, "load snapshot")
+		}
+	} else if err != os.ErrNotExist {
+		return err
+	}
+	bl.snapshot = startSnapshot(storage, key, interval, bl.encode)
+	return nil
+}
+
+// Save snapshot immediately (if persistence enabled)
+func (bl *bloom) Flush() error {
+	if bl.snapshot == nil {
+		return nil
+	}
+	return bl.snapshot.flush()
+}
+
+// Stop periodic snapshots and save final snapshot (if persistence enabled)
+func (bl *bloom) Close() error {
+	if bl.snapshot == nil {
+		return nil
+	}
+	return bl.snapshot.close()
+}
+
+func (bl *bloom) markDirty() {
+	if bl.snapshot != nil {
+		bl.snapshot.markDirty()
+	}
+}
+
+func (bl *bloom) encode() []byte {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+	buf := &bytes.Buffer{}
+	bl.filter.encode(buf)
+	return buf.Bytes()
+}
+
+// Rotating (scalable by time) bloom filter: keys are saved to the current generation of filter designed for
+// itemsPerGeneration keys; when generation is full, new generation is created and the oldest generation is dropped
+// if there are more than generations filters. Keys are checked in all generations, so false-positive rate is bounded
+// by approximately generations * fpRate regardless of stream length, and at least the last
+// (generations - 1) * itemsPerGeneration keys are remembered.
+func RotatingBloom(itemsPerGeneration int, fpRate float64, generations int) *rotatingBloom {
+	if generations <= 0 {
+		generations = 1
+	}
+	return &rotatingBloom{
+		capacity:    itemsPerGeneration,
+		fpRate:      fpRate,
+		generations: generations,
+		filters:     []*filter{newFilter(itemsPerGeneration, fpRate)},
+	}
+}
+
+type rotatingBloom struct {
+	lock        sync.RWMutex
+	capacity    int
+	fpRate      float64
+	generations int
+	filters     []*filter // from the oldest to the current
+	snapshot    *snapshot
+}
+
+func (rb *rotatingBloom) IsDuplicated(key []byte) (bool, error) {
+	rb.lock.RLock()
+	defer rb.lock.RUnlock()
+	return rb.unsafeTest(key), nil
+}
+
+func (rb *rotatingBloom) Save(key []byte) error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.unsafeAdd(key)
+	return nil
+}
+
+// Check and save key atomically (for the instance)
+func (rb *rotatingBloom) SaveIfAbsent(key []byte) (bool, error) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	if rb.unsafeTest(key) {
+		return true, nil
+	}
+	rb.unsafeAdd(key)
+	return false, nil
+}
+
+func (rb *rotatingBloom) unsafeTest(key []byte) bool {
+	for _, f := range rb.filters {
+		if f.test(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rb *rotatingBloom) unsafeAdd(key []byte) {
+	current := rb.filters[len(rb.filters)-1]
+	if current.count >= uint64(rb.capacity) {
+		current = newFilter(rb.capacity, rb.fpRate)
+		rb.filters = append(rb.filters, current)
+		if len(rb.filters) > rb.generations {
+			rb.filters = rb.filters[len(rb.filters)-rb.generations:]
+		}
+	}
+	current.add(key)
+	if rb.snapshot != nil {
+		rb.snapshot.markDirty()
+	}
+}
+
+// Remove all saved keys
+func (rb *rotatingBloom) Clear() error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.filters = []*filter{newFilter(rb.capacity, rb.fpRate)}
+	if rb.snapshot != nil {
+		rb.snapshot.markDirty()
+	}
+	return nil
+}
+
+// Number of generations in use
+func (rb *rotatingBloom) Generations() int {
+	rb.lock.RLock()
+	defer rb.lock.RUnlock()
+	return len(rb.filters)
+}
+
+// Load snapshot of all generations from storage key (if exists) and save snapshot every interval if filter changed.
+// See bloom.Persist for details.
+func (rb *rotatingBloom) Persist(storage storages.KV, key []byte, interval time.Duration) error {
+	data, err := storage.Get(key)
+	if err == nil {
+		err = rb.decode(data)
+		if err != nil {
+			return errors.Wrap(err, "load snapshot")
+		}
+	} else if err != os.ErrNotExist {
+		return err
+	}
+	rb.snapshot = startSnapshot(storage, key, interval, rb.encode)
+	return nil
+}
+
+// Save snapshot immediately (if persistence enabled)
+func (rb *rotatingBloom) Flush() error {
+	if rb.snapshot == nil {
+		return nil
+	}
+	return rb.snapshot.flush()
+}
+
+// Stop periodic snapshots and save final snapshot (if persistence enabled)
+func (rb *rotatingBloom) Close() error {
+	if rb.snapshot == nil {
+		return nil
+	}
+	return rb.snapshot.close()
+}
+
+func (rb *rotatingBloom) encode() []byte {
+	rb.lock.RLock()
+	defer rb.lock.RUnlock()
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, uint64(len(rb.filters)))
+	for _, f := range rb.filters {
+		f.encode(buf)
+	}
+	return buf.Bytes()
+}
+
+func (rb *rotatingBloom) decode(data []byte) error {
+	reader := bytes.NewReader(data)
+	var n uint64
+	err := binary.Read(reader, binary.BigEndian, &n)
+	if err != nil {
+		return err
+	}
+	if n == 0 || n > uint64(rb.generations) {
+		return errors.Errorf("snapshot has %v generations, expected up to %v", n, rb.generations)
+	}
+	var filters = make([]*filter, n)
+	for i := range filters {
+		filters[i] = newFilter(rb.capacity, rb.fpRate)
+		err = filters[i].decode(reader)
+		if err != nil {
+			return errors.Wrapf(err, "generation %v", i)
+		}
+	}
+	rb.filters = filters
+	return nil
+}
+
+// bitset with k hash functions (not thread safe)
+type filter struct {
+	bits  []uint64
+	m     uint64 // number of bits
+	k     uint64 // number of hash functions
+	count uint64 // number of added keys
+}
+
+func newFilter(expectedItems int, fpRate float64) *filter {
+	if expectedItems <= 0 {
+		expectedItems = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	n := float64(expectedItems)
+	m := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (f *filter) add(key []byte) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+func (f *filter) test(key []byte) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+	f.count = 0
+}
+
+// header (m, k, count) and bitset as big-endian uint64
+func (f *filter) encode(buf *bytes.Buffer) {
+	binary.Write(buf, binary.BigEndian, f.m)
+	binary.Write(buf, binary.BigEndian, f.k)
+	binary.Write(buf, binary.BigEndian, f.count)
+	binary.Write(buf, binary.BigEndian, f.bits)
+}
+
+func (f *filter) decode(reader *bytes.Reader) error {
+	var header [3]uint64
+	err := binary.Read(reader, binary.BigEndian, &header)
+	if err != nil {
+		return err
+	}
+	if header[0] != f.m || header[1] != f.k {
+		return errors.Errorf("snapshot parameters (m=%v, k=%v) are not equal to filter parameters (m=%v, k=%v)",
+			header[0], header[1], f.m, f.k)
+	}
+	var bits = make([]uint64, len(f.bits))
+	err = binary.Read(reader, binary.BigEndian, bits)
+	if err != nil {
+		return err
+	}
+	f.bits = bits
+	f.count = header[2]
+	return nil
+}
+
+// double hashing by FNV-1a and FNV-1 (64 bits)
+func hashes(key []byte) (uint64, uint64) {
+	a := fnv.New64a()
+	a.Write(key)
+	b := fnv.New64()
+	b.Write(key)
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// periodic saving of encoded state to storage key
+type snapshot struct {
+	storage  storages.KV
+	key      []byte
+	encode   func() []byte
+	lock     sync.Mutex // serializes saving
+	dirty    uint32     // atomic flag of changes since last saving (failed saving keeps it)
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func startSnapshot(storage storages.KV, key []byte, interval time.Duration, encode func() []byte) *snapshot {
+	snap := &snapshot{
+		storage: storage,
+		key:     key,
+		encode:  encode,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go snap.run(interval)
+	return snap
+}
+
+func (snap *snapshot) run(interval time.Duration) {
+	defer close(snap.done)
+	if interval <= 0 {
+		<-snap.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			snap.flush()
+		case <-snap.stop:
+			return
+		}
+	}
+}
+
+// could be called under lock of filter: does not lock snapshot
+func (snap *snapshot) markDirty() {
+	atomic.StoreUint32(&snap.dirty, 1)
+}
+
+func (snap *snapshot) flush() error {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+	// state could be changed during saving, so mark as clean before encoding
+	if !atomic.CompareAndSwapUint32(&snap.dirty, 1, 0) {
+		return nil
+	}
+	err := snap.storage.Put(snap.key, snap.encode())
+	if err != nil {
+		snap.markDirty()
+	}
+	return err
+}
+
+// stop periodic saving and save final snapshot. Failed background saving is retried by final saving, so only
+// its error is returned
+func (snap *snapshot) close() error {
+	snap.stopOnce.Do(func() { close(snap.stop) })
+	<-snap.done
+	return snap.flush()
+}
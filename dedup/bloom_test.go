@@ -0,0 +1,177 @@
+package dedup
+
+import (
+	"errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBloom(t *testing.T) {
+	bl := Bloom(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		err := bl.Save([]byte("key-" + strconv.Itoa(i)))
+		if err != nil {
+			t.Error("failed keep key:", err)
+			return
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		dup, _ := bl.IsDuplicated([]byte("key-" + strconv.Itoa(i)))
+		if !dup {
+			t.Error("key", i, "should be marked as duplicated")
+			return
+		}
+	}
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		dup, _ := bl.IsDuplicated([]byte("other-" + strconv.Itoa(i)))
+		if dup {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Error("too many false positives:", falsePositives)
+	}
+	if bl.Count() != 1000 {
+		t.Error("count should be 1000, got", bl.Count())
+	}
+	if dup, _ := bl.SaveIfAbsent([]byte("key-0")); !dup {
+		t.Error("saved key should be marked as duplicated")
+	}
+	if dup, _ := bl.SaveIfAbsent([]byte("key-1000")); dup {
+		t.Error("new key should not be marked as duplicated")
+	}
+	if dup, _ := bl.IsDuplicated([]byte("key-1000")); !dup {
+		t.Error("key should be saved if absent")
+	}
+	bl.Clear()
+	if dup, _ := bl.IsDuplicated([]byte("key-0")); dup {
+		t.Error("key should be removed by clear")
+	}
+}
+
+func TestBloomPersist(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	bl := Bloom(100, 0.01)
+	err := bl.Persist(mem, []byte("bloom"), time.Hour)
+	if err != nil {
+		t.Error("failed persist:", err)
+		return
+	}
+	bl.Save([]byte("01"))
+	err = bl.Close()
+	if err != nil {
+		t.Error("failed close:", err)
+		return
+	}
+
+	restored := Bloom(100, 0.01)
+	err = restored.Persist(mem, []byte("bloom"), time.Hour)
+	if err != nil {
+		t.Error("failed restore:", err)
+		return
+	}
+	defer restored.Close()
+	if dup, _ := restored.IsDuplicated([]byte("01")); !dup {
+		t.Error("key should be restored from snapshot")
+	}
+	if dup, _ := restored.IsDuplicated([]byte("02")); dup {
+		t.Error("key should not be marked as duplicated")
+	}
+
+	err = Bloom(200, 0.01).Persist(mem, []byte("bloom"), time.Hour)
+	if err == nil {
+		t.Error("snapshot with different parameters should not be loaded")
+	}
+}
+
+// storage that fails Put while broken flag set
+type flakyStorage struct {
+	storages.KV
+	broken bool
+}
+
+func (fs *flakyStorage) Put(key []byte, data []byte) error {
+	if fs.broken {
+		return errors.New("broken")
+	}
+	return fs.KV.Put(key, data)
+}
+
+func TestBloomPersistRetry(t *testing.T) {
+	storage := &flakyStorage{KV: memstorage.New()}
+	bl := Bloom(100, 0.01)
+	err := bl.Persist(storage, []byte("bloom"), time.Hour)
+	if err != nil {
+		t.Error("failed persist:", err)
+		return
+	}
+	bl.Save([]byte("01"))
+	storage.broken = true
+	if err := bl.Flush(); err == nil {
+		t.Error("flush to broken storage should fail")
+	}
+	// final snapshot is saved after recovery
+	storage.broken = false
+	if err := bl.Close(); err != nil {
+		t.Error("close after recovery should not fail:", err)
+	}
+	if _, err := storage.Get([]byte("bloom")); err != nil {
+		t.Error("snapshot not saved:", err)
+	}
+}
+
+func TestRotatingBloom(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	rb := RotatingBloom(10, 0.01, 2)
+	err := rb.Persist(mem, []byte("bloom"), time.Hour)
+	if err != nil {
+		t.Error("failed persist:", err)
+		return
+	}
+	for i := 0; i < 30; i++ {
+		rb.Save([]byte("key-" + strconv.Itoa(i)))
+	}
+	if rb.Generations() != 2 {
+		t.Error("should be 2 generations, got", rb.Generations())
+	}
+	var forgotten int
+	for i := 0; i < 10; i++ {
+		if dup, _ := rb.IsDuplicated([]byte("key-" + strconv.Itoa(i))); !dup {
+			forgotten++
+		}
+	}
+	if forgotten == 0 {
+		t.Error("the oldest generation should be dropped")
+	}
+	for i := 10; i < 30; i++ {
+		if dup, _ := rb.IsDuplicated([]byte("key-" + strconv.Itoa(i))); !dup {
+			t.Error("key", i, "should be marked as duplicated")
+			return
+		}
+	}
+	err = rb.Close()
+	if err != nil {
+		t.Error("failed close:", err)
+		return
+	}
+
+	restored := RotatingBloom(10, 0.01, 2)
+	err = restored.Persist(mem, []byte("bloom"), time.Hour)
+	if err != nil {
+		t.Error("failed restore:", err)
+		return
+	}
+	defer restored.Close()
+	if restored.Generations() != 2 {
+		t.Error("should be restored 2 generations, got", restored.Generations())
+	}
+	if dup, _ := restored.IsDuplicated([]byte("key-29")); !dup {
+		t.Error("key should be restored from snapshot")
+	}
+}
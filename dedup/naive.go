@@ -53,6 +53,34 @@ func (nv *naive) Save(key []byte) error {
 	if err != nil {
 		return err
 	}
+	return nv.saved()
+}
+
+// Check and save key. Atomic between processes if storage is storages.AtomicStorage, otherwise only for the instance
+func (nv *naive) SaveIfAbsent(key []byte) (bool, error) {
+	nv.lock.Lock()
+	defer nv.lock.Unlock()
+	if atomicStorage, ok := nv.storage.(storages.AtomicStorage); ok {
+		stored, err := atomicStorage.PutIfAbsent(key, []byte(""))
+		if err != nil || !stored {
+			return !stored && err == nil, err
+		}
+		return false, nv.saved()
+	}
+	_, err := nv.storage.Get(key)
+	if err == nil {
+		return true, nil
+	} else if err != os.ErrNotExist {
+		return false, err
+	}
+	err = nv.storage.Put(key, []byte(""))
+	if err != nil {
+		return false, err
+	}
+	return false, nv.saved()
+}
+
+func (nv *naive) saved() error {
 	nv.keys++
 	if nv.keys >= nv.cleanupAmount {
 		// time to cleanup old keys
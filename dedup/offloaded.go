@@ -6,6 +6,7 @@ import (
 	"github.com/reddec/storages"
 	"math/rand"
 	"os"
+	"sync"
 )
 
 // Offloaded deduplication is a wrapper around storage that checks and store keys with random unique iteration id.
@@ -22,32 +23,66 @@ func Offloaded(storage storages.Storage) *offloaded {
 type offloaded struct {
 	iterationID []byte
 	storage     storages.Storage
+	lock        sync.Mutex
 }
 
 func (off *offloaded) IsDuplicated(key []byte) (bool, error) {
-	offloadedIterationId, err := off.storage.Get(key)
-	if err != nil && err != os.ErrNotExist {
-		// problem with offload storage
-		return false, err
-	} else if bytes.Compare(offloadedIterationId, off.iterationID) == 0 {
-		// already used key
-		return true, nil
-	}
-	// new key or key not yet recorded for the iteration
-	return false, nil
+	off.lock.Lock()
+	defer off.lock.Unlock()
+	return off.unsafeIsDuplicated(key)
 }
 
 func (off *offloaded) Save(key []byte) error {
+	off.lock.Lock()
+	defer off.lock.Unlock()
 	return off.storage.Put(key, off.iterationID)
 }
 
+// Check and save key. New keys are saved atomically between processes if storage is storages.AtomicStorage, keys from
+// previous iterations are replaced atomically only for the instance
+func (off *offloaded) SaveIfAbsent(key []byte) (bool, error) {
+	off.lock.Lock()
+	defer off.lock.Unlock()
+	if atomicStorage, ok := off.storage.(storages.AtomicStorage); ok {
+		stored, err := atomicStorage.PutIfAbsent(key, off.iterationID)
+		if err != nil {
+			return false, err
+		}
+		if stored {
+			return false, nil
+		}
+	}
+	duplicated, err := off.unsafeIsDuplicated(key)
+	if err != nil || duplicated {
+		return duplicated, err
+	}
+	return false, off.storage.Put(key, off.iterationID)
+}
+
 func (off *offloaded) Clear() error {
+	off.lock.Lock()
+	defer off.lock.Unlock()
+	// keys from previous iteration should not be treated as duplicates
+	off.reset()
 	if cls, ok := off.storage.(storages.Clearable); ok {
 		return cls.Clear()
 	}
 	return nil
 }
 
+func (off *offloaded) unsafeIsDuplicated(key []byte) (bool, error) {
+	offloadedIterationId, err := off.storage.Get(key)
+	if err != nil && err != os.ErrNotExist {
+		// problem with offload storage
+		return false, err
+	} else if bytes.Compare(offloadedIterationId, off.iterationID) == 0 {
+		// already used key
+		return true, nil
+	}
+	// new key or key not yet recorded for the iteration
+	return false, nil
+}
+
 func (off *offloaded) reset() {
 	var iterationID [8]byte
 	binary.BigEndian.PutUint64(iterationID[:], rand.Uint64())
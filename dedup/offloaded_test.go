@@ -0,0 +1,30 @@
+package dedup
+
+import (
+	"github.com/reddec/storages/std/memstorage"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestOffloadedClear(t *testing.T) {
+	off := Offloaded(memstorage.New())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			off.SaveIfAbsent([]byte("key-" + strconv.Itoa(i)))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := off.Clear(); err != nil {
+			t.Error("failed clear:", err)
+		}
+	}
+	wg.Wait()
+	off.Clear()
+	if dup, _ := off.SaveIfAbsent([]byte("key-0")); dup {
+		t.Error("key should be removed by clear")
+	}
+}
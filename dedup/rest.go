@@ -0,0 +1,65 @@
+package dedup
+
+import (
+	"github.com/reddec/storages"
+	"net/http"
+	"strings"
+)
+
+// Creates new http handler and provides REST-like access to deduplication. Key is a path after / (URL-encoded).
+//
+// GET /:key - check key. Returns 204 if key is duplicated otherwise 404 not found
+//
+// PUT /:key - save key. Returns 204 on success
+//
+// POST /:key - atomically check and save key (see storages.Dedup SaveIfAbsent). Returns 201 if key is new and
+// was saved or 409 conflict if key is duplicated
+//
+// DELETE / - remove all keys if deduplication is storages.Clearable. Returns 204 on success
+func NewServer(dedup storages.Dedup) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		key := []byte(strings.TrimPrefix(request.URL.Path, "/"))
+		if len(key) == 0 {
+			if request.Method != http.MethodDelete {
+				http.Error(writer, "key required", http.StatusBadRequest)
+				return
+			}
+			cls, ok := dedup.(storages.Clearable)
+			if !ok {
+				http.Error(writer, "deduplication is not clearable", http.StatusMethodNotAllowed)
+				return
+			}
+			reply(writer, http.StatusNoContent, cls.Clear())
+			return
+		}
+		switch request.Method {
+		case http.MethodGet:
+			duplicated, err := dedup.IsDuplicated(key)
+			if err == nil && !duplicated {
+				http.NotFound(writer, request)
+				return
+			}
+			reply(writer, http.StatusNoContent, err)
+		case http.MethodPut:
+			reply(writer, http.StatusNoContent, dedup.Save(key))
+		case http.MethodPost:
+			duplicated, err := dedup.SaveIfAbsent(key)
+			if err == nil && duplicated {
+				http.Error(writer, "duplicated", http.StatusConflict)
+				return
+			}
+			reply(writer, http.StatusCreated, err)
+		default:
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func reply(writer http.ResponseWriter, status int, err error) {
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(status)
+}
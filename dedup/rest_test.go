@@ -0,0 +1,50 @@
+package dedup
+
+import (
+	"github.com/reddec/storages/std/memstorage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	nv, err := NewNaive(memstorage.New(), 1000, 2)
+	if err != nil {
+		t.Error("failed initialize naive dedup:", err)
+		return
+	}
+	server := httptest.NewServer(NewServer(nv))
+	defer server.Close()
+
+	do := func(method, path string) int {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(method, path, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := do(http.MethodGet, "/01"); status != http.StatusNotFound {
+		t.Error("new key should be not found, got", status)
+	}
+	if status := do(http.MethodPost, "/01"); status != http.StatusCreated {
+		t.Error("new key should be created, got", status)
+	}
+	if status := do(http.MethodPost, "/01"); status != http.StatusConflict {
+		t.Error("saved key should be conflict, got", status)
+	}
+	if status := do(http.MethodGet, "/01"); status != http.StatusNoContent {
+		t.Error("saved key should be found, got", status)
+	}
+	if status := do(http.MethodPut, "/02"); status != http.StatusNoContent {
+		t.Error("key should be saved, got", status)
+	}
+	if status := do(http.MethodGet, "/02"); status != http.StatusNoContent {
+		t.Error("saved key should be found, got", status)
+	}
+	if status := do(http.MethodDelete, "/"); status != http.StatusMethodNotAllowed {
+		t.Error("naive dedup is not clearable, got", status)
+	}
+}
@@ -0,0 +1,266 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const windowBucketPrefix = "window-"
+
+// Time-windowed deduplication: key is treated as duplicated only if it was saved less than window ago.
+// Keys are saved with timestamp to time-bucketed namespaces (window-<bucket start in unix nanoseconds>) with bucket
+// duration equal to window, so only the current and the previous bucket are checked. Old buckets are removed entirely
+// by DelNamespace during Save once the current bucket is changed (no full scans of keys).
+//
+// Existing buckets are listed once during initialization and tracked in memory, so checks and removal do not list
+// namespaces. Unknown buckets (created by other processes) are opened by storages.ExistingNamespace: checks do not
+// create buckets if storage is storages.ExistingNamespacedStorage, otherwise opened empty bucket is removed as others.
+//
+// Storage keeps keys up to two windows.
+func Windowed(storage storages.NamespacedStorage, window time.Duration) (*windowed, error) {
+	if window <= 0 {
+		return nil, errors.Errorf("window should be positive, got %v", window)
+	}
+	wd := &windowed{
+		storage: storage,
+		window:  window,
+		buckets: make(map[int64]storages.Storage),
+		known:   make(map[int64]bool),
+		now:     time.Now,
+	}
+	err := storage.Namespaces(func(name []byte) error {
+		if start, ok := parseBucket(string(name)); ok {
+			wd.known[start] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list buckets")
+	}
+	return wd, nil
+}
+
+type windowed struct {
+	storage  storages.NamespacedStorage
+	window   time.Duration
+	lock     sync.Mutex                 // protects buckets and cleanup
+	saveLock sync.Mutex                 // serializes SaveIfAbsent
+	buckets  map[int64]storages.Storage // opened buckets by start
+	known    map[int64]bool             // starts of existent buckets
+	cleaned  int64                      // current bucket during last cleanup
+	now      func() time.Time
+}
+
+func (wd *windowed) IsDuplicated(key []byte) (bool, error) {
+	now := wd.now()
+	current := wd.bucketStart(now)
+	for _, start := range []int64{current, current - int64(wd.window)} {
+		saved, err := wd.savedAt(start, key)
+		if err == os.ErrNotExist {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if now.Sub(saved) < wd.window {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (wd *windowed) Save(key []byte) error {
+	now := wd.now()
+	current := wd.bucketStart(now)
+	bucket, err := wd.bucket(current)
+	if err != nil {
+		return err
+	}
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(now.UnixNano()))
+	err = bucket.Put(key, timestamp[:])
+	if err != nil {
+		return err
+	}
+	return wd.cleanup(current)
+}
+
+// Check and save key. Atomic between processes if namespaces are storages.AtomicStorage (key is put to the current
+// bucket only if absent), otherwise only for the instance. Timestamp of duplicated key is not updated
+func (wd *windowed) SaveIfAbsent(key []byte) (bool, error) {
+	wd.saveLock.Lock()
+	defer wd.saveLock.Unlock()
+	now := wd.now()
+	current := wd.bucketStart(now)
+	// key in the current bucket is always in window
+	saved, err := wd.savedAt(current-int64(wd.window), key)
+	if err == nil && now.Sub(saved) < wd.window {
+		return true, nil
+	} else if err != nil && err != os.ErrNotExist {
+		return false, err
+	}
+	bucket, err := wd.bucket(current)
+	if err != nil {
+		return false, err
+	}
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(now.UnixNano()))
+	if atomicBucket, ok := bucket.(storages.AtomicStorage); ok {
+		stored, err := atomicBucket.PutIfAbsent(key, timestamp[:])
+		if err != nil {
+			return false, err
+		}
+		if !stored {
+			return true, nil
+		}
+	} else {
+		_, err = bucket.Get(key)
+		if err == nil {
+			return true, nil
+		} else if err != os.ErrNotExist {
+			return false, err
+		}
+		err = bucket.Put(key, timestamp[:])
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, wd.cleanup(current)
+}
+
+// Remove all buckets
+func (wd *windowed) Clear() error {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	return wd.unsafeDropAll()
+}
+
+// Window of deduplication
+func (wd *windowed) Window() time.Duration { return wd.window }
+
+func (wd *windowed) savedAt(start int64, key []byte) (time.Time, error) {
+	bucket, err := wd.existingBucket(start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if bucket == nil {
+		return time.Time{}, os.ErrNotExist
+	}
+	data, err := bucket.Get(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(data) != 8 {
+		return time.Time{}, errors.Errorf("invalid timestamp of key in bucket %v", start)
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data))), nil
+}
+
+// drop known buckets older than previous (only once per bucket)
+func (wd *windowed) cleanup(current int64) error {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if wd.cleaned == current {
+		return nil
+	}
+	previous := current - int64(wd.window)
+	for start := range wd.known {
+		if start >= previous {
+			continue
+		}
+		err := wd.storage.DelNamespace([]byte(bucketName(start)))
+		if err != nil {
+			return errors.Wrapf(err, "remove old bucket %v", start)
+		}
+		delete(wd.known, start)
+		delete(wd.buckets, start)
+	}
+	wd.cleaned = current
+	return nil
+}
+
+// drop all buckets in storage including buckets of other processes
+func (wd *windowed) unsafeDropAll() error {
+	var old []int64
+	err := wd.storage.Namespaces(func(name []byte) error {
+		if start, ok := parseBucket(string(name)); ok {
+			old = append(old, start)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// remove after iteration: some storages do not allow changes during iteration
+	for _, start := range old {
+		delete(wd.buckets, start)
+		delete(wd.known, start)
+		err = wd.storage.DelNamespace([]byte(bucketName(start)))
+		if err != nil {
+			return errors.Wrapf(err, "remove bucket %v", start)
+		}
+	}
+	return nil
+}
+
+func (wd *windowed) bucket(start int64) (storages.Storage, error) {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if bucket, ok := wd.buckets[start]; ok {
+		return bucket, nil
+	}
+	bucket, err := wd.storage.Namespace([]byte(bucketName(start)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "open bucket %v", start)
+	}
+	wd.buckets[start] = bucket
+	wd.known[start] = true
+	return bucket, nil
+}
+
+// opened or known bucket, otherwise existent bucket of storage. Returns nil if bucket not exists
+func (wd *windowed) existingBucket(start int64) (storages.Storage, error) {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if bucket, ok := wd.buckets[start]; ok {
+		return bucket, nil
+	}
+	name := []byte(bucketName(start))
+	var bucket storages.Storage
+	var err error
+	if wd.known[start] {
+		bucket, err = wd.storage.Namespace(name)
+	} else {
+		bucket, err = storages.ExistingNamespace(wd.storage, name)
+	}
+	if err == os.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "open bucket %v", start)
+	}
+	wd.buckets[start] = bucket
+	wd.known[start] = true
+	return bucket, nil
+}
+
+func (wd *windowed) bucketStart(t time.Time) int64 {
+	unix := t.UnixNano()
+	return unix - unix%int64(wd.window)
+}
+
+func bucketName(start int64) string {
+	return windowBucketPrefix + strconv.FormatInt(start, 10)
+}
+
+func parseBucket(name string) (int64, bool) {
+	if !strings.HasPrefix(name, windowBucketPrefix) {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(name[len(windowBucketPrefix):], 10, 64)
+	return start, err == nil
+}
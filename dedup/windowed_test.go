@@ -0,0 +1,150 @@
+package dedup
+
+import (
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"testing"
+	"time"
+)
+
+func TestWindowed(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	wd, err := Windowed(mem, time.Hour)
+	if err != nil {
+		t.Error("failed initialize windowed dedup:", err)
+		return
+	}
+	now := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	wd.now = func() time.Time { return now }
+
+	err = wd.Save([]byte("01"))
+	if err != nil {
+		t.Error("failed keep key:", err)
+		return
+	}
+	if dup, _ := wd.IsDuplicated([]byte("01")); !dup {
+		t.Error("key should be marked as duplicated")
+	}
+	if dup, _ := wd.IsDuplicated([]byte("02")); dup {
+		t.Error("key should not be marked as duplicated")
+	}
+
+	// next bucket, but still in window
+	now = now.Add(50 * time.Minute)
+	if dup, _ := wd.IsDuplicated([]byte("01")); !dup {
+		t.Error("key from previous bucket should be marked as duplicated")
+	}
+	wd.Save([]byte("02"))
+
+	// out of window, but still in previous bucket
+	now = now.Add(20 * time.Minute)
+	if dup, _ := wd.IsDuplicated([]byte("01")); dup {
+		t.Error("expired key should not be marked as duplicated")
+	}
+
+	// two buckets later: the first bucket should be removed
+	now = now.Add(time.Hour)
+	wd.Save([]byte("03"))
+	var buckets int
+	mem.Namespaces(func(name []byte) error {
+		buckets++
+		return nil
+	})
+	if buckets != 2 {
+		t.Error("should be 2 buckets after cleanup, got", buckets)
+	}
+	if dup, _ := wd.IsDuplicated([]byte("03")); !dup {
+		t.Error("key should be marked as duplicated")
+	}
+	if dup, _ := wd.SaveIfAbsent([]byte("03")); !dup {
+		t.Error("saved key should be marked as duplicated")
+	}
+	if dup, _ := wd.SaveIfAbsent([]byte("04")); dup {
+		t.Error("new key should not be marked as duplicated")
+	}
+	if dup, _ := wd.IsDuplicated([]byte("04")); !dup {
+		t.Error("key should be saved if absent")
+	}
+
+	err = wd.Clear()
+	if err != nil {
+		t.Error("failed clear:", err)
+		return
+	}
+	if dup, _ := wd.IsDuplicated([]byte("03")); dup {
+		t.Error("key should be removed by clear")
+	}
+}
+
+func TestWindowed_buckets(t *testing.T) {
+	mem := &listCounter{NamespacedStorage: memstorage.New()}
+	defer mem.Close()
+	now := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	// bucket left by previous run
+	old, _ := mem.Namespace([]byte(bucketName(now.Add(-5 * time.Hour).Truncate(time.Hour).UnixNano())))
+	old.Put([]byte("01"), make([]byte, 8))
+
+	wd, err := Windowed(mem, time.Hour)
+	if err != nil {
+		t.Error("failed initialize windowed dedup:", err)
+		return
+	}
+	wd.now = func() time.Time { return now }
+	mem.lists = 0
+
+	if dup, _ := wd.IsDuplicated([]byte("01")); dup {
+		t.Error("key should not be marked as duplicated")
+	}
+	if names, _ := storages.AllNamespacesString(mem.NamespacedStorage); len(names) != 1 {
+		t.Error("check should not create buckets, got", names)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = wd.Save([]byte("01"))
+		if err != nil {
+			t.Error("failed keep key:", err)
+			return
+		}
+		if dup, _ := wd.IsDuplicated([]byte("02")); dup {
+			t.Error("key should not be marked as duplicated")
+		}
+		now = now.Add(time.Hour)
+	}
+	if mem.lists != 0 {
+		t.Error("namespaces should be listed only during initialization, listed", mem.lists, "times")
+	}
+	if names, _ := storages.AllNamespacesString(mem.NamespacedStorage); len(names) != 2 {
+		t.Error("should be 2 buckets after cleanup, got", names)
+	}
+
+	// bucket created by another instance
+	other, err := Windowed(mem, time.Hour)
+	if err != nil {
+		t.Error("failed initialize windowed dedup:", err)
+		return
+	}
+	other.now = wd.now
+	err = other.Save([]byte("03"))
+	if err != nil {
+		t.Error("failed keep key:", err)
+		return
+	}
+	if dup, _ := wd.IsDuplicated([]byte("03")); !dup {
+		t.Error("key saved by another instance should be marked as duplicated")
+	}
+}
+
+type listCounter struct {
+	storages.NamespacedStorage
+	lists int
+}
+
+func (lc *listCounter) Namespaces(handler func(name []byte) error) error {
+	lc.lists++
+	return lc.NamespacedStorage.Namespaces(handler)
+}
+
+func (lc *listCounter) ExistingNamespace(name []byte) (storages.Storage, error) {
+	return storages.ExistingNamespace(lc.NamespacedStorage, name)
+}
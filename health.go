@@ -0,0 +1,152 @@
+package storages
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Health check for backend storage. Non-nil error marks storage as unhealthy
+type HealthCheck func(storage Storage) error
+
+// Health check based on reading sentinel key. Missed key (os.ErrNotExist) is treated as healthy
+func SentinelCheck(key []byte) HealthCheck {
+	return func(storage Storage) error {
+		_, err := storage.Get(key)
+		if err == os.ErrNotExist {
+			return nil
+		}
+		return err
+	}
+}
+
+// Status of backend storage
+type ReplicaStatus struct {
+	Index     int       `json:"index"`                // index of storage in list of backends
+	Healthy   bool      `json:"healthy"`              // result of last check
+	LastCheck time.Time `json:"last_check"`           // time of last check (zero if check not yet executed)
+	LastError string    `json:"last_error,omitempty"` // error of last failed check
+}
+
+// Storage that can report health of underlying storages
+type HealthReporter interface {
+	// Health status of each backend storage
+	Health() []ReplicaStatus
+}
+
+type healthMonitor struct {
+	check    HealthCheck
+	interval time.Duration
+	lock     sync.RWMutex
+	status   []ReplicaStatus
+	running  []uint32 // 1 if check of storage is in progress
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newHealthMonitor(interval time.Duration, check HealthCheck, backed []Storage) *healthMonitor {
+	status := make([]ReplicaStatus, len(backed))
+	for i := range status {
+		status[i] = ReplicaStatus{Index: i, Healthy: true}
+	}
+	hm := &healthMonitor{
+		check:    check,
+		interval: interval,
+		status:   status,
+		running:  make([]uint32, len(backed)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hm.run(backed)
+	return hm
+}
+
+func (hm *healthMonitor) run(backed []Storage) {
+	defer close(hm.done)
+	ticker := time.NewTicker(hm.interval)
+	defer ticker.Stop()
+	for {
+		hm.probe(backed)
+		select {
+		case <-ticker.C:
+		case <-hm.stop:
+			return
+		}
+	}
+}
+
+// run checks concurrently: each check should finish during interval, otherwise storage is marked as unhealthy.
+// Timed out check is not restarted till it finished
+func (hm *healthMonitor) probe(backed []Storage) {
+	ctx, cancel := context.WithTimeout(context.Background(), hm.interval)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, stor := range backed {
+		if !atomic.CompareAndSwapUint32(&hm.running[i], 0, 1) {
+			hm.report(i, errors.New("previous health check is still running"))
+			continue
+		}
+		wg.Add(1)
+		go func(i int, stor Storage) {
+			defer wg.Done()
+			result := make(chan error, 1)
+			go func() {
+				defer atomic.StoreUint32(&hm.running[i], 0)
+				result <- hm.check(stor)
+			}()
+			select {
+			case err := <-result:
+				hm.report(i, err)
+			case <-ctx.Done():
+				hm.report(i, errors.Wrap(ctx.Err(), "health check"))
+			}
+		}(i, stor)
+	}
+	wg.Wait()
+}
+
+func (hm *healthMonitor) report(i int, err error) {
+	now := time.Now()
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+	hm.status[i].LastCheck = now
+	hm.status[i].Healthy = err == nil
+	if err != nil {
+		hm.status[i].LastError = err.Error()
+	} else {
+		hm.status[i].LastError = ""
+	}
+}
+
+// healthy storages or all storages if there is no healthy one
+func (hm *healthMonitor) filter(backed []Storage) []Storage {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	var ans = make([]Storage, 0, len(backed))
+	for i, stor := range backed {
+		if hm.status[i].Healthy {
+			ans = append(ans, stor)
+		}
+	}
+	if len(ans) == 0 {
+		return backed
+	}
+	return ans
+}
+
+func (hm *healthMonitor) snapshot() []ReplicaStatus {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	var ans = make([]ReplicaStatus, len(hm.status))
+	copy(ans, hm.status)
+	return ans
+}
+
+func (hm *healthMonitor) Close() error {
+	close(hm.stop)
+	<-hm.done
+	return nil
+}
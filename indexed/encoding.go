@@ -0,0 +1,134 @@
+package indexed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// Order-preserving encodings of secondary keys for ordered index: bytewise order of encoded values
+// is the same as natural order of values.
+
+// Encode unsigned integer as big-endian 8 bytes
+func Uint64(value uint64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], value)
+	return data[:]
+}
+
+// Encode signed integer as big-endian 8 bytes with flipped sign bit (negative values go first)
+func Int64(value int64) []byte {
+	return Uint64(uint64(value) ^ (1 << 63))
+}
+
+// Encode float as 8 bytes: sign bit flipped for positive values and all bits flipped for negative values.
+// NaN values are ordered after +Inf (or before -Inf for negative NaN)
+func Float64(value float64) []byte {
+	bits := math.Float64bits(value)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits ^= 1 << 63
+	}
+	return Uint64(bits)
+}
+
+// Decode unsigned integer encoded by Uint64
+func DecodeUint64(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, errors.Errorf("invalid length of encoded integer: %v", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// Decode signed integer encoded by Int64
+func DecodeInt64(data []byte) (int64, error) {
+	value, err := DecodeUint64(data)
+	return int64(value ^ (1 << 63)), err
+}
+
+// Decode float encoded by Float64
+func DecodeFloat64(data []byte) (float64, error) {
+	bits, err := DecodeUint64(data)
+	if err != nil {
+		return 0, err
+	}
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// Encode composite key (tuple) of encoded parts: tuples are ordered by the first part, then by the second and so on.
+// Each part is escaped (0x00 -> 0x00 0xFF) and terminated by 0x00 0x01, so tuple with fewer parts is a prefix of
+// tuple with more parts and the same leading parts (could be used by FindPrefix).
+func Tuple(parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, part := range parts {
+		writeTuplePart(&buf, part)
+	}
+	return buf.Bytes()
+}
+
+// Decode parts of tuple encoded by Tuple
+func DecodeTuple(data []byte) ([][]byte, error) {
+	var parts [][]byte
+	for len(data) > 0 {
+		part, tail, err := readTuplePart(data)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		data = tail
+	}
+	return parts, nil
+}
+
+// escaped data (not nil)
+func escape(data []byte) []byte {
+	var buf bytes.Buffer
+	writeEscaped(&buf, data)
+	return append([]byte{}, buf.Bytes()...)
+}
+
+func writeTuplePart(buf *bytes.Buffer, part []byte) {
+	writeEscaped(buf, part)
+	buf.WriteByte(0x00)
+	buf.WriteByte(0x01)
+}
+
+func writeEscaped(buf *bytes.Buffer, data []byte) {
+	for _, b := range data {
+		buf.WriteByte(b)
+		if b == 0x00 {
+			buf.WriteByte(0xFF)
+		}
+	}
+}
+
+// read escaped part till terminator and return rest of data
+func readTuplePart(data []byte) ([]byte, []byte, error) {
+	var part = []byte{}
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0x00 {
+			part = append(part, data[i])
+			continue
+		}
+		if i+1 >= len(data) {
+			return nil, nil, errors.New("unexpected end of tuple")
+		}
+		switch data[i+1] {
+		case 0x01:
+			return part, data[i+2:], nil
+		case 0xFF:
+			part = append(part, 0x00)
+			i++
+		default:
+			return nil, nil, errors.Errorf("invalid escape sequence at %v", i)
+		}
+	}
+	return nil, nil, errors.New("tuple part is not terminated")
+}
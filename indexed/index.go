@@ -17,7 +17,8 @@ func NewUniqueIndex(storage storages.Storage) Index {
 // Creates new non-unique index backed by dedicated storage. Multiple links
 // with a same secondary key will be packed to array (encoded by GOB, but it could be changed).
 // Important! Due to process of appending/modify arrays is in memory, user should be aware of
-// badly distributed secondary keys (where there are a lot of same secondary keys).
+// badly distributed secondary keys (where there are a lot of same secondary keys). See NewOrderedIndex and
+// NewNamespacedIndex for such cases.
 func NewIndex(storage storages.Storage) Index {
 	return &multiIndex{index: storage}
 }
@@ -36,6 +37,7 @@ type Index interface {
 
 type uniqueIndex struct {
 	index storages.Storage
+	lock  sync.Mutex
 }
 
 func (uq *uniqueIndex) Find(secondaryKey []byte) ([][]byte, error) {
@@ -47,10 +49,24 @@ func (uq *uniqueIndex) Find(secondaryKey []byte) ([][]byte, error) {
 }
 
 func (uq *uniqueIndex) Unlink(primaryKey, secondaryKey []byte) error {
+	uq.lock.Lock()
+	defer uq.lock.Unlock()
+	// secondary key could be already linked to another primary key
+	pk, err := uq.index.Get(secondaryKey)
+	if err == os.ErrNotExist {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(pk, primaryKey) {
+		return nil
+	}
 	return uq.index.Del(secondaryKey)
 }
 
 func (uq *uniqueIndex) Link(primaryKey, secondaryKey []byte) error {
+	uq.lock.Lock()
+	defer uq.lock.Unlock()
 	return uq.index.Put(secondaryKey, primaryKey)
 }
 
@@ -93,7 +109,10 @@ func (mi *multiIndex) Unlink(primaryKey, secondaryKey []byte) error {
 			j++
 		}
 	}
-	return mi.savePrimaryKeys(secondaryKey, primaryKeys)
+	if j == 0 {
+		return mi.index.Del(secondaryKey)
+	}
+	return mi.savePrimaryKeys(secondaryKey, cp[:j])
 }
 
 func (mi *multiIndex) Link(primaryKey, secondaryKey []byte) error {
@@ -103,6 +122,12 @@ func (mi *multiIndex) Link(primaryKey, secondaryKey []byte) error {
 	if err != nil {
 		return err
 	}
+	for _, key := range primaryKeys {
+		if bytes.Equal(key, primaryKey) {
+			// already linked
+			return nil
+		}
+	}
 	primaryKeys = append(primaryKeys, primaryKey)
 	return mi.savePrimaryKeys(secondaryKey, primaryKeys)
 }
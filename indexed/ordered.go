@@ -0,0 +1,110 @@
+package indexed
+
+import (
+	"bytes"
+	"github.com/reddec/storages"
+	"os"
+)
+
+// Index with ordered secondary keys: supports range and prefix queries
+type OrderedIndex interface {
+	StreamingIndex
+	// Iterate over entries with secondary keys in range [from, to) in order of secondary keys.
+	// Nil from or to means unbounded range
+	FindRange(from, to []byte, handler func(primaryKey, secondaryKey []byte) error) error
+	// Iterate over entries with secondary keys that starts with prefix in order of secondary keys
+	FindPrefix(prefix []byte, handler func(primaryKey, secondaryKey []byte) error) error
+}
+
+// Creates new non-unique ordered index backed by dedicated storage. Secondary keys are compared bytewise, so
+// numbers and composite keys should be encoded order-preservingly (see Uint64, Int64, Float64 and Tuple).
+//
+// Each link is stored as separate key in storage: escaped secondary key, terminator and primary key
+// (see Tuple), with empty value. Range and prefix queries use storages.OrderedStorage if supported, otherwise
+// all keys of index are filtered and sorted in memory. Find uses storages.PrefixedStorage if supported.
+func NewOrderedIndex(storage storages.Storage) OrderedIndex {
+	return &orderedIndex{index: storage}
+}
+
+type orderedIndex struct {
+	index storages.Storage
+}
+
+func (oi *orderedIndex) Link(primaryKey, secondaryKey []byte) error {
+	return oi.index.Put(oi.entryKey(primaryKey, secondaryKey), []byte{})
+}
+
+func (oi *orderedIndex) Unlink(primaryKey, secondaryKey []byte) error {
+	err := oi.index.Del(oi.entryKey(primaryKey, secondaryKey))
+	if err == os.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+func (oi *orderedIndex) Find(secondaryKey []byte) ([][]byte, error) {
+	var primaryKeys [][]byte
+	err := oi.FindEach(secondaryKey, func(primaryKey []byte) error {
+		primaryKeys = append(primaryKeys, primaryKey)
+		return nil
+	})
+	return primaryKeys, err
+}
+
+func (oi *orderedIndex) Iterate(handler func(primaryKey, secondaryKey []byte) error) error {
+	return oi.index.Keys(func(key []byte) error {
+		return oi.decode(key, handler)
+	})
+}
+
+func (oi *orderedIndex) FindRange(from, to []byte, handler func(primaryKey, secondaryKey []byte) error) error {
+	// escaped secondary key is less than any entry key of the same secondary key
+	var start, end []byte
+	if from != nil {
+		start = escape(from)
+	}
+	if to != nil {
+		end = escape(to)
+	}
+	return storages.KeysRange(oi.index, start, end, func(key []byte) error {
+		return oi.decode(key, handler)
+	})
+}
+
+func (oi *orderedIndex) FindPrefix(prefix []byte, handler func(primaryKey, secondaryKey []byte) error) error {
+	start := escape(prefix)
+	return storages.KeysRange(oi.index, start, prefixEnd(start), func(key []byte) error {
+		return oi.decode(key, handler)
+	})
+}
+
+func (oi *orderedIndex) entryKey(primaryKey, secondaryKey []byte) []byte {
+	var buf bytes.Buffer
+	writeTuplePart(&buf, secondaryKey)
+	buf.Write(primaryKey)
+	return buf.Bytes()
+}
+
+// decode entry key and copy parts (key could be reused by storage)
+func (oi *orderedIndex) decode(key []byte, handler func(primaryKey, secondaryKey []byte) error) error {
+	secondaryKey, primaryKey, err := readTuplePart(key)
+	if err != nil {
+		return err
+	}
+	cp := make([]byte, len(primaryKey))
+	copy(cp, primaryKey)
+	return handler(cp, secondaryKey)
+}
+
+// the smallest key greater than all keys with prefix or nil if there is no such key
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xFF {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package indexed
+
+import (
+	"bytes"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/boltdb"
+	"github.com/reddec/storages/std/memstorage"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestEncodingOrder(t *testing.T) {
+	ints := []int64{math.MinInt64, -100, -1, 0, 1, 100, math.MaxInt64}
+	for i := 1; i < len(ints); i++ {
+		if bytes.Compare(Int64(ints[i-1]), Int64(ints[i])) >= 0 {
+			t.Error("order of", ints[i-1], "and", ints[i], "is not preserved")
+		}
+		decoded, err := DecodeInt64(Int64(ints[i]))
+		if err != nil || decoded != ints[i] {
+			t.Error("failed decode", ints[i], decoded, err)
+		}
+	}
+	floats := []float64{math.Inf(-1), -1e10, -1.5, -0.1, 0, 0.1, 1.5, 1e10, math.Inf(1)}
+	for i := 1; i < len(floats); i++ {
+		if bytes.Compare(Float64(floats[i-1]), Float64(floats[i])) >= 0 {
+			t.Error("order of", floats[i-1], "and", floats[i], "is not preserved")
+		}
+		decoded, err := DecodeFloat64(Float64(floats[i]))
+		if err != nil || decoded != floats[i] {
+			t.Error("failed decode", floats[i], decoded, err)
+		}
+	}
+	tuples := [][][]byte{
+		{[]byte("a")},
+		{[]byte("a"), []byte("")},
+		{[]byte("a"), []byte("b")},
+		{[]byte("a\x00")},
+		{[]byte("a\x00"), []byte("a")},
+		{[]byte("ab")},
+		{[]byte("b"), Int64(-1)},
+		{[]byte("b"), Int64(1)},
+	}
+	for i := 1; i < len(tuples); i++ {
+		if bytes.Compare(Tuple(tuples[i-1]...), Tuple(tuples[i]...)) >= 0 {
+			t.Errorf("order of %q and %q is not preserved", tuples[i-1], tuples[i])
+		}
+	}
+	parts, err := DecodeTuple(Tuple([]byte("a\x00b"), []byte{}, []byte("c")))
+	if err != nil || len(parts) != 3 || string(parts[0]) != "a\x00b" || len(parts[1]) != 0 || string(parts[2]) != "c" {
+		t.Errorf("failed decode tuple: %q %v", parts, err)
+	}
+}
+
+func TestOrderedIndex(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testOrderedIndex(t, memstorage.New())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		stor, err := boltdb.NewDefault(filepath.Join(dir, "index.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stor.Close()
+		if _, ok := interface{}(stor).(storages.OrderedStorage); !ok {
+			t.Fatal("bolt should be ordered storage")
+		}
+		testOrderedIndex(t, stor)
+	})
+}
+
+func testOrderedIndex(t *testing.T, storage storages.Storage) {
+	index := NewOrderedIndex(storage)
+	prices := map[string]float64{"1": 10.5, "2": -3, "3": 99, "4": 10.5, "5": 0}
+	for id, price := range prices {
+		err := index.Link([]byte(id), Float64(price))
+		if err != nil {
+			t.Fatal("link:", err)
+		}
+	}
+
+	collect := func(find func(handler func(primaryKey, secondaryKey []byte) error) error) []string {
+		var ids []string
+		err := find(func(primaryKey, secondaryKey []byte) error {
+			ids = append(ids, string(primaryKey))
+			return nil
+		})
+		if err != nil {
+			t.Fatal("find:", err)
+		}
+		return ids
+	}
+
+	ids := collect(func(handler func(primaryKey, secondaryKey []byte) error) error {
+		return index.FindRange(Float64(0), Float64(99), handler)
+	})
+	if len(ids) != 3 || ids[0] != "5" || !(ids[1] == "1" || ids[1] == "4") {
+		t.Error("price in [0, 99) should be 5, 1, 4 in order, got", ids)
+	}
+	ids = collect(func(handler func(primaryKey, secondaryKey []byte) error) error {
+		return index.FindRange(nil, Float64(0), handler)
+	})
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Error("negative price should be 2, got", ids)
+	}
+
+	primaryKeys, err := index.Find(Float64(10.5))
+	if err != nil {
+		t.Fatal("find:", err)
+	}
+	var found []string
+	for _, pk := range primaryKeys {
+		found = append(found, string(pk))
+	}
+	sort.Strings(found)
+	if len(found) != 2 || found[0] != "1" || found[1] != "4" {
+		t.Error("price 10.5 should be 1 and 4, got", found)
+	}
+
+	err = index.Unlink([]byte("1"), Float64(10.5))
+	if err != nil {
+		t.Fatal("unlink:", err)
+	}
+	primaryKeys, _ = index.Find(Float64(10.5))
+	if len(primaryKeys) != 1 || string(primaryKeys[0]) != "4" {
+		t.Error("price 10.5 should be only 4 after unlink")
+	}
+
+	// composite keys: (category, price)
+	_ = index.Link([]byte("6"), Tuple([]byte("books"), Float64(5)))
+	_ = index.Link([]byte("7"), Tuple([]byte("books"), Float64(1)))
+	_ = index.Link([]byte("8"), Tuple([]byte("games"), Float64(2)))
+	ids = collect(func(handler func(primaryKey, secondaryKey []byte) error) error {
+		return index.FindPrefix(Tuple([]byte("books")), handler)
+	})
+	if len(ids) != 2 || ids[0] != "7" || ids[1] != "6" {
+		t.Error("books should be 7, 6 ordered by price, got", ids)
+	}
+
+	var total int
+	err = index.Iterate(func(primaryKey, secondaryKey []byte) error {
+		total++
+		return nil
+	})
+	if err != nil || total != 7 {
+		t.Error("should be 7 entries, got", total, err)
+	}
+}
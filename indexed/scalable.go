@@ -0,0 +1,119 @@
+package indexed
+
+import (
+	"github.com/reddec/storages"
+	"os"
+)
+
+// Index with streaming access to primary keys
+type StreamingIndex interface {
+	Index
+	// Iterate over primary keys linked to secondary key without loading all of them to memory
+	FindEach(secondaryKey []byte, handler func(primaryKey []byte) error) error
+}
+
+// Creates new non-unique index that stores primary keys of each secondary key in separate namespace
+// (name is a secondary key). Link and Unlink are a single Put and Del, Find iterates over keys of one namespace only.
+// Find and Unlink do not create namespaces if storage is storages.ExistingNamespacedStorage (BoltDB, memory),
+// otherwise namespace is opened directly and empty namespace means no links.
+//
+// Storage should be dedicated to the index: all namespaces are treated as secondary keys. Empty namespaces
+// could be kept after Unlink (depends on storage). Secondary key should be a valid namespace name for the storage
+// (for example, not empty for BoltDB).
+func NewNamespacedIndex(storage storages.NamespacedStorage) StreamingIndex {
+	return &namespacedIndex{index: storage}
+}
+
+type namespacedIndex struct {
+	index storages.NamespacedStorage
+}
+
+func (ni *namespacedIndex) Link(primaryKey, secondaryKey []byte) error {
+	ns, err := ni.index.Namespace(secondaryKey)
+	if err != nil {
+		return err
+	}
+	return ns.Put(primaryKey, []byte{})
+}
+
+func (ni *namespacedIndex) Unlink(primaryKey, secondaryKey []byte) error {
+	ns, err := ni.existing(secondaryKey)
+	if err != nil || ns == nil {
+		return err
+	}
+	err = ns.Del(primaryKey)
+	if err == os.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+func (ni *namespacedIndex) Find(secondaryKey []byte) ([][]byte, error) {
+	var primaryKeys [][]byte
+	err := ni.FindEach(secondaryKey, func(primaryKey []byte) error {
+		primaryKeys = append(primaryKeys, primaryKey)
+		return nil
+	})
+	return primaryKeys, err
+}
+
+func (ni *namespacedIndex) FindEach(secondaryKey []byte, handler func(primaryKey []byte) error) error {
+	ns, err := ni.existing(secondaryKey)
+	if err != nil || ns == nil {
+		return err
+	}
+	return primaryKeys(ns, handler)
+}
+
+func (ni *namespacedIndex) Iterate(handler func(primaryKey, secondaryKey []byte) error) error {
+	// some storages do not allow opening namespaces during iteration
+	var names [][]byte
+	err := ni.index.Namespaces(func(name []byte) error {
+		cp := make([]byte, len(name))
+		copy(cp, name)
+		names = append(names, cp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, secondaryKey := range names {
+		ns, err := ni.index.Namespace(secondaryKey)
+		if err != nil {
+			return err
+		}
+		err = primaryKeys(ns, func(primaryKey []byte) error {
+			return handler(primaryKey, secondaryKey)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespace of secondary key or nil if namespace not exists
+func (ni *namespacedIndex) existing(secondaryKey []byte) (storages.Storage, error) {
+	ns, err := storages.ExistingNamespace(ni.index, secondaryKey)
+	if err == os.ErrNotExist {
+		return nil, nil
+	}
+	return ns, err
+}
+
+func primaryKeys(ns storages.Storage, handler func(primaryKey []byte) error) error {
+	return ns.Keys(func(key []byte) error {
+		// key could be reused by storage
+		cp := make([]byte, len(key))
+		copy(cp, key)
+		return handler(cp)
+	})
+}
+
+func (oi *orderedIndex) FindEach(secondaryKey []byte, handler func(primaryKey []byte) error) error {
+	return storages.KeysPrefix(oi.index, Tuple(secondaryKey), func(key []byte) error {
+		return oi.decode(key, func(primaryKey, _ []byte) error {
+			return handler(primaryKey)
+		})
+	})
+}
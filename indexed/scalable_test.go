@@ -0,0 +1,129 @@
+package indexed
+
+import (
+	"errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/boltdb"
+	"github.com/reddec/storages/std/memstorage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestStreamingIndex(t *testing.T) {
+	t.Run("ordered", func(t *testing.T) {
+		testStreamingIndex(t, NewOrderedIndex(memstorage.New()))
+	})
+	t.Run("namespaced", func(t *testing.T) {
+		stor := memstorage.New()
+		testStreamingIndex(t, NewNamespacedIndex(stor))
+		testNoNamespace(t, stor)
+	})
+	t.Run("namespaced-bolt", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		stor, err := boltdb.New(filepath.Join(dir, "index.db"), []byte("primary"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stor.Close()
+		testStreamingIndex(t, NewNamespacedIndex(stor))
+		testNoNamespace(t, stor)
+	})
+}
+
+// reading of unknown secondary key should not create namespace
+func testNoNamespace(t *testing.T, stor storages.NamespacedStorage) {
+	names, err := storages.AllNamespacesString(stor)
+	if err != nil {
+		t.Fatal("namespaces:", err)
+	}
+	for _, name := range names {
+		if name == "1980" {
+			t.Error("namespace of unknown secondary key created")
+		}
+	}
+}
+
+func testStreamingIndex(t *testing.T, index StreamingIndex) {
+	const users = 1000
+	for i := 0; i < users; i++ {
+		year := "1990"
+		if i%10 == 0 {
+			year = "2000"
+		}
+		err := index.Link([]byte(strconv.Itoa(i)), []byte(year))
+		if err != nil {
+			t.Fatal("link:", err)
+		}
+	}
+
+	// unknown secondary key
+	primaryKeys, err := index.Find([]byte("1980"))
+	if err != nil || len(primaryKeys) != 0 {
+		t.Error("unknown secondary key should have no primary keys, got", len(primaryKeys), err)
+	}
+	err = index.Unlink([]byte("1"), []byte("1980"))
+	if err != nil {
+		t.Error("unlink of unknown secondary key:", err)
+	}
+
+	primaryKeys, err = index.Find([]byte("2000"))
+	if err != nil {
+		t.Fatal("find:", err)
+	}
+	if len(primaryKeys) != users/10 {
+		t.Error("should be", users/10, "primary keys, got", len(primaryKeys))
+	}
+
+	// streaming find could be stopped
+	errStop := errors.New("stop")
+	var visited int
+	err = index.FindEach([]byte("1990"), func(primaryKey []byte) error {
+		visited++
+		if visited == 5 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || visited != 5 {
+		t.Error("iteration should be stopped after 5 keys, got", visited, err)
+	}
+
+	for i := 0; i < users; i += 10 {
+		if i == 0 {
+			continue
+		}
+		err = index.Unlink([]byte(strconv.Itoa(i)), []byte("2000"))
+		if err != nil {
+			t.Fatal("unlink:", err)
+		}
+	}
+	primaryKeys, _ = index.Find([]byte("2000"))
+	if len(primaryKeys) != 1 || string(primaryKeys[0]) != "0" {
+		t.Errorf("only 0 should be left, got %q", primaryKeys)
+	}
+
+	var secondaryKeys = map[string]int{}
+	err = index.Iterate(func(primaryKey, secondaryKey []byte) error {
+		secondaryKeys[string(secondaryKey)]++
+		return nil
+	})
+	if err != nil {
+		t.Fatal("iterate:", err)
+	}
+	var names []string
+	for name := range secondaryKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if secondaryKeys["1990"] != users-users/10 || secondaryKeys["2000"] != 1 {
+		t.Error("unexpected entries:", secondaryKeys)
+	}
+}
@@ -0,0 +1,220 @@
+package indexed
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"sync"
+)
+
+// Extract secondary keys from record (primary key and value). Nil result means record is not indexed
+type Extractor func(key, value []byte) [][]byte
+
+// Named secondary index with extractor of secondary keys
+type Definition struct {
+	Name    string
+	Index   Index
+	Extract Extractor
+}
+
+// Creates storage wrapper that maintains secondary indexes automatically: on Put secondary keys of old value
+// are unlinked and secondary keys of new value are linked, on Del secondary keys are unlinked.
+//
+// Indexes are updated after primary storage, so in case of failure indexes could be stale (records found by stale
+// secondary keys are skipped by FindBy, however records with not linked keys will not be found). Use Reindex to
+// rebuild indexes. Changes should be made only through the wrapper.
+func Storage(primary storages.Storage, indexes ...Definition) *indexedStorage {
+	var byName = make(map[string]Definition, len(indexes))
+	for _, def := range indexes {
+		byName[def.Name] = def
+	}
+	return &indexedStorage{
+		primary: primary,
+		indexes: indexes,
+		byName:  byName,
+	}
+}
+
+type indexedStorage struct {
+	primary storages.Storage
+	indexes []Definition
+	byName  map[string]Definition
+	lock    sync.Mutex
+}
+
+func (is *indexedStorage) Put(key []byte, data []byte) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+	old, err := is.primary.Get(key)
+	if err != nil && err != os.ErrNotExist {
+		return errors.Wrap(err, "get old value")
+	}
+	exists := err == nil
+	err = is.primary.Put(key, data)
+	if err != nil {
+		return err
+	}
+	for _, def := range is.indexes {
+		var oldKeys [][]byte
+		if exists {
+			oldKeys = def.Extract(key, old)
+		}
+		newKeys := def.Extract(key, data)
+		for _, secondaryKey := range difference(oldKeys, newKeys) {
+			err = def.Index.Unlink(key, secondaryKey)
+			if err != nil {
+				return errors.Wrapf(err, "unlink from index %v", def.Name)
+			}
+		}
+		for _, secondaryKey := range difference(newKeys, oldKeys) {
+			err = def.Index.Link(key, secondaryKey)
+			if err != nil {
+				return errors.Wrapf(err, "link to index %v", def.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (is *indexedStorage) Get(key []byte) ([]byte, error) {
+	return is.primary.Get(key)
+}
+
+func (is *indexedStorage) Del(key []byte) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+	old, err := is.primary.Get(key)
+	if err == os.ErrNotExist {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "get old value")
+	}
+	err = is.primary.Del(key)
+	if err != nil {
+		return err
+	}
+	for _, def := range is.indexes {
+		for _, secondaryKey := range def.Extract(key, old) {
+			err = def.Index.Unlink(key, secondaryKey)
+			if err != nil {
+				return errors.Wrapf(err, "unlink from index %v", def.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (is *indexedStorage) Keys(handler func(key []byte) error) error {
+	return is.primary.Keys(handler)
+}
+
+// Close primary storage. Storages of indexes are not closed
+func (is *indexedStorage) Close() error {
+	return is.primary.Close()
+}
+
+// Find values by secondary key in index. Primary keys without values (stale index) are skipped
+func (is *indexedStorage) FindBy(indexName string, secondaryKey []byte) ([][]byte, error) {
+	def, ok := is.byName[indexName]
+	if !ok {
+		return nil, errors.Errorf("unknown index %v", indexName)
+	}
+	primaryKeys, err := def.Index.Find(secondaryKey)
+	if err == os.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var values = make([][]byte, 0, len(primaryKeys))
+	for _, primaryKey := range primaryKeys {
+		value, err := is.primary.Get(primaryKey)
+		if err == os.ErrNotExist {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "get value of %v", string(primaryKey))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Index by name or nil
+func (is *indexedStorage) Index(indexName string) Index {
+	return is.byName[indexName].Index
+}
+
+// Remove all entries from indexes and link records from primary storage again (keys of primary storage are
+// loaded to memory)
+func (is *indexedStorage) Reindex() error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+	for _, def := range is.indexes {
+		err := clearIndex(def.Index)
+		if err != nil {
+			return errors.Wrapf(err, "clear index %v", def.Name)
+		}
+	}
+	// some storages do not allow reading during iteration
+	keys, err := storages.AllKeys(is.primary)
+	if err != nil {
+		return errors.Wrap(err, "get primary keys")
+	}
+	for _, key := range keys {
+		value, err := is.primary.Get(key)
+		if err == os.ErrNotExist {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "get value of %v", string(key))
+		}
+		for _, def := range is.indexes {
+			for _, secondaryKey := range def.Extract(key, value) {
+				err = def.Index.Link(key, secondaryKey)
+				if err != nil {
+					return errors.Wrapf(err, "link to index %v", def.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func clearIndex(index Index) error {
+	type entry struct{ primaryKey, secondaryKey []byte }
+	var entries []entry
+	// index could be locked during iteration, so unlink after
+	err := index.Iterate(func(primaryKey, secondaryKey []byte) error {
+		entries = append(entries, entry{primaryKey: primaryKey, secondaryKey: secondaryKey})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err = index.Unlink(e.primaryKey, e.secondaryKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keys from a that are not in b
+func difference(a, b [][]byte) [][]byte {
+	var ans [][]byte
+	for _, key := range a {
+		if !contains(b, key) {
+			ans = append(ans, key)
+		}
+	}
+	return ans
+}
+
+func contains(list [][]byte, key []byte) bool {
+	for _, item := range list {
+		if bytes.Equal(item, key) {
+			return true
+		}
+	}
+	return false
+}
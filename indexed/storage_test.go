@@ -0,0 +1,111 @@
+package indexed
+
+import (
+	"github.com/reddec/storages/std/memstorage"
+	"sort"
+	"testing"
+)
+
+type testUser struct {
+	ID    string
+	Email string
+	Tags  []string
+}
+
+func byEmail(key, value []byte) [][]byte {
+	var user testUser
+	fromJSON(value, &user)
+	if user.Email == "" {
+		return nil
+	}
+	return [][]byte{[]byte(user.Email)}
+}
+
+func byTag(key, value []byte) [][]byte {
+	var user testUser
+	fromJSON(value, &user)
+	var ans [][]byte
+	for _, tag := range user.Tags {
+		ans = append(ans, []byte(tag))
+	}
+	return ans
+}
+
+func findIDs(t *testing.T, stor *indexedStorage, index string, secondaryKey string) []string {
+	values, err := stor.FindBy(index, []byte(secondaryKey))
+	if err != nil {
+		t.Fatal("find by", index, err)
+	}
+	var ids []string
+	for _, value := range values {
+		var user testUser
+		fromJSON(value, &user)
+		ids = append(ids, user.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestStorage(t *testing.T) {
+	primary := memstorage.New()
+	stor := Storage(primary,
+		Definition{Name: "email", Index: NewUniqueIndex(memstorage.New()), Extract: byEmail},
+		Definition{Name: "tag", Index: NewIndex(memstorage.New()), Extract: byTag})
+	defer stor.Close()
+
+	put := func(user testUser) {
+		err := stor.Put([]byte(user.ID), toJSON(user))
+		if err != nil {
+			t.Fatal("put", user.ID, err)
+		}
+	}
+	put(testUser{ID: "1", Email: "alice@example.com", Tags: []string{"admin", "dev"}})
+	put(testUser{ID: "2", Email: "bob@example.com", Tags: []string{"dev"}})
+
+	if ids := findIDs(t, stor, "email", "alice@example.com"); len(ids) != 1 || ids[0] != "1" {
+		t.Error("alice should be found by email:", ids)
+	}
+	if ids := findIDs(t, stor, "tag", "dev"); len(ids) != 2 {
+		t.Error("two users should be found by tag:", ids)
+	}
+
+	// change email and tags
+	put(testUser{ID: "1", Email: "alice@example.org", Tags: []string{"admin"}})
+	if ids := findIDs(t, stor, "email", "alice@example.com"); len(ids) != 0 {
+		t.Error("old email should be unlinked:", ids)
+	}
+	if ids := findIDs(t, stor, "email", "alice@example.org"); len(ids) != 1 {
+		t.Error("new email should be linked:", ids)
+	}
+	if ids := findIDs(t, stor, "tag", "dev"); len(ids) != 1 || ids[0] != "2" {
+		t.Error("old tag should be unlinked:", ids)
+	}
+
+	err := stor.Del([]byte("2"))
+	if err != nil {
+		t.Fatal("del:", err)
+	}
+	if ids := findIDs(t, stor, "tag", "dev"); len(ids) != 0 {
+		t.Error("removed record should be unlinked:", ids)
+	}
+
+	if _, err := stor.FindBy("unknown", []byte("x")); err == nil {
+		t.Error("unknown index should cause error")
+	}
+
+	// changes made directly in primary storage are visible after reindex
+	_ = primary.Put([]byte("3"), toJSON(testUser{ID: "3", Email: "eve@example.com", Tags: []string{"admin"}}))
+	if ids := findIDs(t, stor, "tag", "admin"); len(ids) != 1 {
+		t.Error("not indexed record should not be found:", ids)
+	}
+	err = stor.Reindex()
+	if err != nil {
+		t.Fatal("reindex:", err)
+	}
+	if ids := findIDs(t, stor, "tag", "admin"); len(ids) != 2 {
+		t.Error("all records should be found after reindex:", ids)
+	}
+	if ids := findIDs(t, stor, "email", "eve@example.com"); len(ids) != 1 || ids[0] != "3" {
+		t.Error("record should be found by email after reindex:", ids)
+	}
+}
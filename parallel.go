@@ -0,0 +1,75 @@
+package storages
+
+import (
+	"errors"
+	"sync"
+)
+
+var errIterationCanceled = errors.New("iteration canceled")
+
+// Iterate over keys of several storages concurrently with at most concurrency storages at a time.
+// Handler invocations are serialized, so handler should not be thread-safe. First error (from storage or
+// handler) cancels iteration: not started storages will be skipped and running will be stopped on next key.
+// Non-positive concurrency means all storages at once.
+func ParallelKeys(list []Storage, concurrency int, handler func(key []byte) error) error {
+	if concurrency <= 0 || concurrency > len(list) {
+		concurrency = len(list)
+	}
+	var (
+		handlerLock sync.Mutex
+		errLock     sync.Mutex
+		firstErr    error
+		canceled    = make(chan struct{})
+		tasks       = make(chan Storage)
+		wg          sync.WaitGroup
+	)
+
+	fail := func(err error) {
+		errLock.Lock()
+		defer errLock.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			close(canceled)
+		}
+	}
+
+	serialized := func(key []byte) error {
+		handlerLock.Lock()
+		defer handlerLock.Unlock()
+		select {
+		case <-canceled:
+			return errIterationCanceled
+		default:
+		}
+		err := handler(key)
+		if err != nil {
+			fail(err)
+		}
+		return err
+	}
+
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for storage := range tasks {
+				err := storage.Keys(serialized)
+				if err != nil && err != errIterationCanceled {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, storage := range list {
+		select {
+		case tasks <- storage:
+		case <-canceled:
+			break feed
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	return firstErr
+}
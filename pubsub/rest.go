@@ -0,0 +1,101 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"github.com/reddec/storages/queues"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Creates new http handler and provides REST-like access to topic.
+//
+// POST /publish - publish message to all subscriptions. Returns 204 on success
+//
+// GET /subscriptions - list of subscriptions names as JSON array
+//
+// PUT /subscriptions/:name - create subscription (if not exists). Returns 204 on success
+//
+// DELETE /subscriptions/:name - remove subscription. Returns 204 on success or 404 if subscription not exists
+//
+// /subscriptions/:name/... - access to queue of subscription as reliable queue (see queues.NewServer),
+// like POST /subscriptions/:name/reserve and POST /subscriptions/:name/ack/:id
+func NewServer(t *topic) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/publish", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodPost && request.Method != http.MethodPut {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = t.Publish(data)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/subscriptions", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodGet {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(t.Subscriptions())
+	})
+	mux.HandleFunc("/subscriptions/", func(writer http.ResponseWriter, request *http.Request) {
+		path := strings.TrimPrefix(request.URL.Path, "/subscriptions/")
+		name, rest := path, ""
+		if idx := strings.Index(path, "/"); idx != -1 {
+			name, rest = path[:idx], path[idx:]
+		}
+		if name == "" {
+			http.NotFound(writer, request)
+			return
+		}
+		if rest == "" {
+			manageSubscription(t, name, writer, request)
+			return
+		}
+		sub, err := t.Subscription(name)
+		if err == os.ErrNotExist {
+			http.NotFound(writer, request)
+			return
+		} else if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		request.URL.Path = rest
+		queues.NewServer(sub.Queue()).ServeHTTP(writer, request)
+	})
+	return mux
+}
+
+func manageSubscription(t *topic, name string, writer http.ResponseWriter, request *http.Request) {
+	defer request.Body.Close()
+	var err error
+	switch request.Method {
+	case http.MethodPut, http.MethodPost:
+		_, err = t.Subscribe(name)
+	case http.MethodDelete:
+		err = t.Unsubscribe(name)
+	default:
+		http.Error(writer, "no method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == os.ErrNotExist {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/reddec/storages"
+	"time"
+)
+
+// Default time for processing of received message. Not acknowledged message will be delivered again after timeout
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// reliable queue with blocking reserve (see queues.Reliable)
+type reliableQueue interface {
+	storages.ReliableQueue
+	ReserveWait(ctx context.Context, timeout time.Duration) (uint64, []byte, error)
+}
+
+// Durable subscription of topic
+type subscription struct {
+	name    string
+	storage storages.Storage
+	queue   reliableQueue
+	timeout time.Duration
+}
+
+// Received message. Message should be acknowledged after processing, otherwise it will be delivered again
+type Message struct {
+	ID   uint64 // unique (in subscription) id of message
+	Data []byte
+	sub  *subscription
+}
+
+// Mark message as processed
+func (m *Message) Ack() error { return m.sub.queue.Ack(m.ID) }
+
+// Return message to subscription for immediate redelivery
+func (m *Message) Nack() error { return m.sub.queue.Nack(m.ID) }
+
+// Name of subscription
+func (s *subscription) Name() string { return s.name }
+
+// Queue of subscription (could be exposed by queues.NewServer)
+func (s *subscription) Queue() storages.ReliableQueue { return s.queue }
+
+// Set visibility timeout (see DefaultVisibilityTimeout). Should be called before usage
+func (s *subscription) WithVisibilityTimeout(timeout time.Duration) *subscription {
+	s.timeout = timeout
+	return s
+}
+
+// Receive next message. Blocks until message available or context done
+func (s *subscription) Receive(ctx context.Context) (*Message, error) {
+	id, data, err := s.queue.ReserveWait(ctx, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{ID: id, Data: data, sub: s}, nil
+}
+
+// Receive messages and process them by handler till context done or receive error. Message is acknowledged if
+// handler returns nil, otherwise message will be delivered again after visibility timeout (at-least-once).
+// Handler errors do not stop listening.
+func (s *subscription) Listen(ctx context.Context, handler func(data []byte) error) error {
+	for {
+		msg, err := s.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		if handler(msg.Data) != nil {
+			continue
+		}
+		err = msg.Ack()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Receive messages to channel till context done or receive error (channel will be closed). Messages should be
+// acknowledged by receiver
+func (s *subscription) Messages(ctx context.Context) <-chan *Message {
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+		for {
+			msg, err := s.Receive(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				// not delivered message will be returned after visibility timeout, but it could be done faster
+				msg.Nack()
+				return
+			}
+		}
+	}()
+	return ch
+}
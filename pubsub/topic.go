@@ -0,0 +1,227 @@
+// Publish-subscribe over any namespaced storage. Each subscription is a durable reliable queue in own namespace,
+// published data is copied to all subscriptions (fan-out), so subscribers consume data independently and
+// at-least-once.
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/queues"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	subscriptionsKey  = "subscriptions" // list of subscriptions names
+	subscriptionSpace = "subscription:" // prefix for namespaces of subscriptions
+)
+
+// Open topic in storage. Subscriptions are restored from the storage. Only subscriptions that exist at the moment
+// of publishing receive data. List of subscriptions is re-read from the storage on each Publish, Subscribe,
+// Unsubscribe and lookup of unknown subscription, so subscriptions created or removed by other processes that share
+// the storage are visible. Subscriptions removed by other processes are not published anymore, but stay open for
+// local users till topic is closed
+func NewTopic(storage storages.NamespacedStorage) (*topic, error) {
+	t := &topic{
+		storage:       storage,
+		subscriptions: make(map[string]*subscription),
+	}
+	err := t.unsafeRefresh()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+type topic struct {
+	storage       storages.NamespacedStorage
+	lock          sync.RWMutex
+	subscriptions map[string]*subscription
+	detached      []*subscription // removed by other processes, closed with topic
+}
+
+// Publish data to all subscriptions
+func (t *topic) Publish(data []byte) error {
+	t.lock.Lock()
+	err := t.unsafeRefresh()
+	t.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for name, sub := range t.subscriptions {
+		err := sub.queue.Put(data)
+		if err != nil {
+			return errors.Wrapf(err, "publish to subscription %v", name)
+		}
+	}
+	return nil
+}
+
+// Get or create durable subscription. New subscription receives only data published after creation
+func (t *topic) Subscribe(name string) (*subscription, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	err := t.unsafeRefresh()
+	if err != nil {
+		return nil, err
+	}
+	if sub, ok := t.subscriptions[name]; ok {
+		return sub, nil
+	}
+	sub, err := t.open(name)
+	if err != nil {
+		return nil, err
+	}
+	t.subscriptions[name] = sub
+	err = t.unsafeSave()
+	if err != nil {
+		delete(t.subscriptions, name)
+		sub.storage.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Get existing subscription. Returns os.ErrNotExist if subscription is not defined
+func (t *topic) Subscription(name string) (*subscription, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	sub, ok := t.subscriptions[name]
+	if ok {
+		return sub, nil
+	}
+	// could be created by another process
+	err := t.unsafeRefresh()
+	if err != nil {
+		return nil, err
+	}
+	sub, ok = t.subscriptions[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return sub, nil
+}
+
+// Remove subscription and all its data. Subscription should not be used after
+func (t *topic) Unsubscribe(name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	err := t.unsafeRefresh()
+	if err != nil {
+		return err
+	}
+	sub, ok := t.subscriptions[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(t.subscriptions, name)
+	err = t.unsafeSave()
+	if err != nil {
+		t.subscriptions[name] = sub
+		return err
+	}
+	sub.storage.Close()
+	return t.storage.DelNamespace([]byte(subscriptionSpace + name))
+}
+
+// Names of subscriptions in lexicographical order
+func (t *topic) Subscriptions() []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.unsafeNames()
+}
+
+// Close storages of subscriptions (including removed by other processes). Topic storage is not closed
+func (t *topic) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, sub := range t.subscriptions {
+		sub.storage.Close()
+	}
+	for _, sub := range t.detached {
+		sub.storage.Close()
+	}
+	t.detached = nil
+	return nil
+}
+
+func (t *topic) open(name string) (*subscription, error) {
+	storage, err := t.storage.Namespace([]byte(subscriptionSpace + name))
+	if err != nil {
+		return nil, err
+	}
+	queue, err := queues.Reliable(storage)
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	return &subscription{
+		name:    name,
+		storage: storage,
+		queue:   queue,
+		timeout: DefaultVisibilityTimeout,
+	}, nil
+}
+
+// sync opened subscriptions with list in storage
+func (t *topic) unsafeRefresh() error {
+	names, err := loadSubscriptions(t.storage)
+	if err != nil {
+		return errors.Wrap(err, "load subscriptions")
+	}
+	var actual = make(map[string]bool, len(names))
+	for _, name := range names {
+		actual[name] = true
+		if _, ok := t.subscriptions[name]; ok {
+			continue
+		}
+		sub, err := t.open(name)
+		if err != nil {
+			return errors.Wrapf(err, "open subscription %v", name)
+		}
+		t.subscriptions[name] = sub
+	}
+	// removed by other processes: subscription could be still used locally, so it is closed with topic
+	for name, sub := range t.subscriptions {
+		if !actual[name] {
+			t.detached = append(t.detached, sub)
+			delete(t.subscriptions, name)
+		}
+	}
+	return nil
+}
+
+func (t *topic) unsafeNames() []string {
+	var names = make([]string, 0, len(t.subscriptions))
+	for name := range t.subscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *topic) unsafeSave() error {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(t.unsafeNames())
+	if err != nil {
+		return err
+	}
+	return t.storage.Put([]byte(subscriptionsKey), buf.Bytes())
+}
+
+func loadSubscriptions(storage storages.KV) ([]string, error) {
+	data, err := storage.Get([]byte(subscriptionsKey))
+	if err == os.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	return names, gob.NewDecoder(bytes.NewReader(data)).Decode(&names)
+}
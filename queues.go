@@ -1,5 +1,10 @@
 package storages
 
+import (
+	"context"
+	"time"
+)
+
 // Wrapper around storage that makes sequential data inserting and peeking
 // Without external access to the data Queue guarantees that sequences are without space and strictly increasing.
 // If queue has no data sequence is flushed (starts from 0) after restart
@@ -33,6 +38,63 @@ type Queue interface {
 	Get() ([]byte, error)
 }
 
+// Queue with acknowledgement of processed records (at-least-once delivery)
+type ReliableQueue interface {
+	Queue
+	// Reserve oldest record for processing. Record will be returned to the queue if it will not be acknowledged
+	// till timeout (visibility timeout). Returns os.ErrNotExists if queue is empty
+	Reserve(timeout time.Duration) (id uint64, data []byte, err error)
+	// Acknowledge reserved record as processed and remove it. Returns os.ErrNotExists if record not reserved
+	Ack(id uint64) error
+	// Return reserved record to the queue immediately. Returns os.ErrNotExists if record not reserved
+	Nack(id uint64) error
+}
+
+// Queue with scheduled delivery: record is not available for reading till due time
+type DelayedQueue interface {
+	Queue
+	// Put data to the queue that will be available at defined time
+	PutAt(data []byte, at time.Time) error
+	// Put data to the queue that will be available after delay
+	PutAfter(data []byte, delay time.Duration) error
+}
+
+// Queue with blocking read
+type BlockingQueue interface {
+	Queue
+	// Get oldest data and remove it. Blocks until data available or context done
+	GetWait(ctx context.Context) ([]byte, error)
+}
+
+// Queue with batch operations
+type BatchedQueue interface {
+	Queue
+	// Put several data to the queue in the same order
+	PutBatch(items [][]byte) error
+	// Get at most max oldest data and remove them. If queue is empty - os.ErrNotExist
+	GetBatch(max int) ([][]byte, error)
+}
+
+// Queue with access to records without consuming
+type BrowsableQueue interface {
+	Queue
+	// Number of records
+	Len() int
+	// Iterate over records starting from id in order of adding
+	Range(fromID uint64, handler func(id uint64, data []byte) error) error
+	// Remove all records
+	Purge() error
+	// Remove record by id. If not exists - os.ErrNotExist
+	DeleteByID(id uint64) error
+}
+
+// Queue with priorities of records
+type PriorityQueue interface {
+	Queue
+	// Put data to the queue with defined priority
+	PutPriority(data []byte, priority int) error
+}
+
 // Queue iterator
 type Iterator interface {
 	// Is queue has next value
@@ -0,0 +1,42 @@
+package queues
+
+import (
+	"github.com/reddec/storages"
+	"os"
+)
+
+// Put several data to the queue. Uses storages.BatchedQueue if supported, otherwise puts data one by one
+func PutBatch(queue storages.Queue, items [][]byte) error {
+	if batched, ok := queue.(storages.BatchedQueue); ok {
+		return batched.PutBatch(items)
+	}
+	for _, item := range items {
+		err := queue.Put(item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get at most max oldest data from the queue. Uses storages.BatchedQueue if supported, otherwise gets data
+// one by one. If queue is empty - os.ErrNotExist
+func GetBatch(queue storages.Queue, max int) ([][]byte, error) {
+	if batched, ok := queue.(storages.BatchedQueue); ok {
+		return batched.GetBatch(max)
+	}
+	var ans [][]byte
+	for len(ans) < max {
+		data, err := queue.Get()
+		if err == os.ErrNotExist {
+			break
+		} else if err != nil {
+			return ans, err
+		}
+		ans = append(ans, data)
+	}
+	if len(ans) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return ans, nil
+}
@@ -0,0 +1,206 @@
+package queues
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"sync"
+)
+
+// Queue has no space for new data
+var ErrQueueFull = errors.New("queue is full")
+
+// Behaviour of bounded queue when there is no space for new data
+type OverflowPolicy int
+
+const (
+	DropOldest OverflowPolicy = iota // remove the oldest data to free space
+	Reject                           // return ErrQueueFull
+	Block                            // wait until space available
+)
+
+// Naive queue limited by number of records. Non-positive capacity means unlimited. See BoundedBytes for details
+func Bounded(storage storages.KV, capacity int, policy OverflowPolicy) (*boundedQueue, error) {
+	return bounded(storage, capacity, 0, policy)
+}
+
+// Naive queue limited by total size of data. Non-positive maxBytes means unlimited. Size of existing data is
+// calculated during initialization by reading all records. Data larger than maxBytes is rejected by ErrQueueFull
+// regardless of policy.
+//
+// Limits are checked only for changes made by the same instance.
+func BoundedBytes(storage storages.KV, maxBytes int64, policy OverflowPolicy) (*boundedQueue, error) {
+	return bounded(storage, 0, maxBytes, policy)
+}
+
+func bounded(storage storages.KV, capacity int, maxBytes int64, policy OverflowPolicy) (*boundedQueue, error) {
+	queue, err := NaiveQueue(storage)
+	if err != nil {
+		return nil, err
+	}
+	bq := &boundedQueue{
+		queue:    queue,
+		capacity: capacity,
+		maxBytes: maxBytes,
+		policy:   policy,
+	}
+	if maxBytes > 0 {
+		for seq := queue.oldestSequence; seq <= queue.latestSequence; seq++ {
+			key := queue.getKey(seq)
+			data, err := storage.Get(key[:])
+			if err == os.ErrNotExist {
+				continue // removed by DeleteByID
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "calculate size of record %v", seq)
+			}
+			bq.bytes += int64(len(data))
+		}
+	}
+	return bq, nil
+}
+
+type boundedQueue struct {
+	queue    *naiveQueue
+	capacity int
+	maxBytes int64
+	policy   OverflowPolicy
+	lock     sync.Mutex
+	bytes    int64    // total size of data
+	space    notifier // notification about freed space
+}
+
+// Put data according to overflow policy. With Block policy waits until space available
+func (bq *boundedQueue) Put(data []byte) error {
+	return bq.PutWait(context.Background(), data)
+}
+
+// Put data according to overflow policy. With Block policy waits until space available or context done
+func (bq *boundedQueue) PutWait(ctx context.Context, data []byte) error {
+	size := int64(len(data))
+	if bq.maxBytes > 0 && size > bq.maxBytes {
+		return ErrQueueFull
+	}
+	for {
+		bq.lock.Lock()
+		if !bq.unsafeFits(size) {
+			switch bq.policy {
+			case Reject:
+				bq.lock.Unlock()
+				return ErrQueueFull
+			case Block:
+				space := bq.space.notification()
+				bq.lock.Unlock()
+				select {
+				case <-space:
+					continue
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			default:
+				err := bq.unsafeDropOldest(size)
+				if err != nil {
+					bq.lock.Unlock()
+					return errors.Wrap(err, "drop oldest data")
+				}
+			}
+		}
+		err := bq.queue.Put(data)
+		if err == nil {
+			bq.bytes += size
+		}
+		bq.lock.Unlock()
+		return err
+	}
+}
+
+func (bq *boundedQueue) Peek() ([]byte, error) {
+	return bq.queue.Peek()
+}
+
+func (bq *boundedQueue) Get() ([]byte, error) {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	data, err := bq.queue.Get()
+	if err != nil {
+		return nil, err
+	}
+	bq.unsafeFreed(int64(len(data)))
+	return data, nil
+}
+
+func (bq *boundedQueue) Discard() error {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	return bq.unsafeDiscard()
+}
+
+// Get oldest data and remove it. Blocks until data available or context done
+func (bq *boundedQueue) GetWait(ctx context.Context) ([]byte, error) {
+	return GetWait(ctx, bq)
+}
+
+// Number of records in queue
+func (bq *boundedQueue) Len() int {
+	return bq.queue.Len()
+}
+
+// Maximum number of records (0 - unlimited)
+func (bq *boundedQueue) Cap() int { return bq.capacity }
+
+// Total size of data in queue
+func (bq *boundedQueue) Bytes() int64 {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	return bq.bytes
+}
+
+// Maximum total size of data (0 - unlimited)
+func (bq *boundedQueue) MaxBytes() int64 { return bq.maxBytes }
+
+func (bq *boundedQueue) notification() <-chan struct{} {
+	return bq.queue.notification()
+}
+
+func (bq *boundedQueue) waitData(ctx context.Context, notification <-chan struct{}) error {
+	return bq.queue.waitData(ctx, notification)
+}
+
+func (bq *boundedQueue) unsafeFits(size int64) bool {
+	if bq.capacity > 0 && bq.Len() >= bq.capacity {
+		return false
+	}
+	return bq.maxBytes <= 0 || bq.bytes+size <= bq.maxBytes
+}
+
+func (bq *boundedQueue) unsafeDropOldest(size int64) error {
+	for !bq.unsafeFits(size) {
+		err := bq.unsafeDiscard()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bq *boundedQueue) unsafeDiscard() error {
+	var size int64
+	if bq.maxBytes > 0 {
+		data, err := bq.queue.Peek()
+		if err != nil && err != os.ErrNotExist {
+			return err
+		}
+		size = int64(len(data))
+	}
+	err := bq.queue.Discard()
+	if err != nil {
+		return err
+	}
+	bq.unsafeFreed(size)
+	return nil
+}
+
+func (bq *boundedQueue) unsafeFreed(size int64) {
+	bq.bytes -= size
+	bq.space.notify()
+}
@@ -0,0 +1,181 @@
+package queues
+
+import (
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"github.com/reddec/storages"
+	"os"
+	"sync"
+	"time"
+)
+
+const delayedKeySize = 16 // due time (8 bytes) + sequence (8 bytes)
+
+// Queue with scheduled delivery based on any storage. Keys are big-endian due time (unix nanoseconds) followed by
+// big-endian sequence number, so records with the same due time keep FIFO order. Records are available for reading
+// (Peek, Get, Discard) only after due time in order of due time. Put stores records with current time.
+//
+// All keys are scanned during initialization to restore schedule, other keys are ignored.
+func Delayed(storage storages.Storage) (*delayedQueue, error) {
+	dq := &delayedQueue{storage: storage}
+	err := storage.Keys(func(key []byte) error {
+		if len(key) != delayedKeySize {
+			return nil // skip other keys
+		}
+		var k delayedKey
+		copy(k[:], key)
+		dq.schedule = append(dq.schedule, k)
+		if seq := binary.BigEndian.Uint64(k[8:]); seq > dq.sequence {
+			dq.sequence = seq
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	heap.Init(&dq.schedule)
+	return dq, nil
+}
+
+type delayedQueue struct {
+	storage  storages.Storage
+	schedule delayedKeys // min-heap of keys
+	sequence uint64      // last used sequence
+	lock     sync.Mutex
+	signal   notifier
+}
+
+func (dq *delayedQueue) Put(data []byte) error {
+	return dq.PutAt(data, time.Now())
+}
+
+func (dq *delayedQueue) PutAfter(data []byte, delay time.Duration) error {
+	return dq.PutAt(data, time.Now().Add(delay))
+}
+
+func (dq *delayedQueue) PutAt(data []byte, at time.Time) error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	var key delayedKey
+	binary.BigEndian.PutUint64(key[:8], uint64(at.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], dq.sequence+1)
+	err := dq.storage.Put(key[:], data)
+	if err != nil {
+		return err
+	}
+	dq.sequence++
+	heap.Push(&dq.schedule, key)
+	dq.signal.notify()
+	return nil
+}
+
+// Get due data and remove it. Blocks until the nearest record is due or context done
+func (dq *delayedQueue) GetWait(ctx context.Context) ([]byte, error) {
+	return GetWait(ctx, dq)
+}
+
+func (dq *delayedQueue) notification() <-chan struct{} {
+	return dq.signal.notification()
+}
+
+func (dq *delayedQueue) waitData(ctx context.Context, notification <-chan struct{}) error {
+	var due <-chan time.Time
+	if next, ok := dq.Next(); ok {
+		timer := time.NewTimer(time.Until(next))
+		defer timer.Stop()
+		due = timer.C
+	}
+	select {
+	case <-notification:
+	case <-due:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (dq *delayedQueue) Peek() ([]byte, error) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	data, _, err := dq.unsafePeek()
+	return data, err
+}
+
+func (dq *delayedQueue) Discard() error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	_, _, err := dq.unsafePeek()
+	if err != nil {
+		return err
+	}
+	return dq.unsafeDiscard()
+}
+
+func (dq *delayedQueue) Get() ([]byte, error) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	data, _, err := dq.unsafePeek()
+	if err != nil {
+		return nil, err
+	}
+	return data, dq.unsafeDiscard()
+}
+
+// Time of the nearest scheduled record. Returns false if queue is empty
+func (dq *delayedQueue) Next() (time.Time, bool) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	if len(dq.schedule) == 0 {
+		return time.Time{}, false
+	}
+	return dq.schedule[0].due(), true
+}
+
+// due record: records removed from storage by others are dropped from schedule
+func (dq *delayedQueue) unsafePeek() ([]byte, delayedKey, error) {
+	for dq.isDue() {
+		key := dq.schedule[0]
+		data, err := dq.storage.Get(key[:])
+		if err == os.ErrNotExist {
+			heap.Pop(&dq.schedule)
+			continue
+		}
+		return data, key, err
+	}
+	return nil, delayedKey{}, os.ErrNotExist
+}
+
+func (dq *delayedQueue) unsafeDiscard() error {
+	key := dq.schedule[0]
+	err := dq.storage.Del(key[:])
+	if err != nil && err != os.ErrNotExist {
+		return err
+	}
+	heap.Pop(&dq.schedule)
+	return nil
+}
+
+func (dq *delayedQueue) isDue() bool {
+	return len(dq.schedule) > 0 && !dq.schedule[0].due().After(time.Now())
+}
+
+type delayedKey [delayedKeySize]byte
+
+func (dk delayedKey) due() time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(dk[:8])))
+}
+
+// min-heap of keys, byte order is the same as order of due time and sequence
+type delayedKeys []delayedKey
+
+func (dk delayedKeys) Len() int            { return len(dk) }
+func (dk delayedKeys) Less(i, j int) bool  { return string(dk[i][:]) < string(dk[j][:]) }
+func (dk delayedKeys) Swap(i, j int)       { dk[i], dk[j] = dk[j], dk[i] }
+func (dk *delayedKeys) Push(x interface{}) { *dk = append(*dk, x.(delayedKey)) }
+func (dk *delayedKeys) Pop() interface{} {
+	old := *dk
+	item := old[len(old)-1]
+	*dk = old[:len(old)-1]
+	return item
+}
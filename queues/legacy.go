@@ -0,0 +1,103 @@
+package queues
+
+import (
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"sync"
+)
+
+// Expose legacy queue as FIFO queue: Peek, Get and Discard work with the oldest (first) record,
+// Put appends record to the end.
+func FromLegacy(queue storages.LegacyQueue) *legacyAdapter {
+	return &legacyAdapter{queue: queue}
+}
+
+type legacyAdapter struct {
+	queue storages.LegacyQueue
+	lock  sync.Mutex
+}
+
+func (la *legacyAdapter) Put(data []byte) error {
+	_, err := la.queue.Put(data)
+	return err
+}
+
+func (la *legacyAdapter) Peek() ([]byte, error) {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+	_, data, err := la.oldest()
+	return data, err
+}
+
+func (la *legacyAdapter) Get() ([]byte, error) {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+	id, data, err := la.oldest()
+	if err != nil {
+		return nil, err
+	}
+	return data, la.queue.Clean(id + 1)
+}
+
+func (la *legacyAdapter) Discard() error {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+	id, _, err := la.oldest()
+	if err != nil {
+		return err
+	}
+	return la.queue.Clean(id + 1)
+}
+
+func (la *legacyAdapter) oldest() (int64, []byte, error) {
+	if la.queue.Size() <= 0 {
+		return 0, nil, os.ErrNotExist
+	}
+	it := la.queue.Iterate(0)
+	if !it.Next() {
+		return 0, nil, os.ErrNotExist
+	}
+	return it.ID(), it.Value(), nil
+}
+
+// Move all records from legacy queue layout (Simple, decimal keys) in storage to naive queue layout in target.
+// Target could be the same storage (in-place migration): layouts do not intersect. Records are put to the target
+// before removing from source, so interrupted migration may cause duplicates but not losses and could be repeated.
+// Returns number of moved records.
+func MigrateToNaive(storage storages.Storage, target storages.KV) (int, error) {
+	legacy, err := Simple(storage)
+	if err != nil {
+		return 0, errors.Wrap(err, "open legacy queue")
+	}
+	naive, err := NaiveQueue(target)
+	if err != nil {
+		return 0, errors.Wrap(err, "open target queue")
+	}
+	return Redrive(FromLegacy(legacy), naive, 0)
+}
+
+// Move all records from naive queue layout in storage to legacy queue layout (Simple, decimal keys) in target.
+// Target could be the same storage (in-place migration). Sequence pointers of naive queue are removed after
+// migration. See MigrateToNaive for details.
+func MigrateToLegacy(storage storages.KV, target storages.Storage) (int, error) {
+	naive, err := NaiveQueue(storage)
+	if err != nil {
+		return 0, errors.Wrap(err, "open naive queue")
+	}
+	legacy, err := Simple(target)
+	if err != nil {
+		return 0, errors.Wrap(err, "open target queue")
+	}
+	moved, err := Redrive(naive, FromLegacy(legacy), 0)
+	if err != nil {
+		return moved, err
+	}
+	for _, key := range []string{latestSequenceKey, oldestSequenceKey, deletedCountKey} {
+		err = storage.Del([]byte(key))
+		if err != nil && err != os.ErrNotExist {
+			return moved, errors.Wrapf(err, "remove %v sequence", key)
+		}
+	}
+	return moved, nil
+}
@@ -0,0 +1,329 @@
+package queues
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Offset could not be committed: not yet appended or before already committed offset
+var ErrInvalidOffset = errors.New("invalid offset")
+
+const (
+	logGroupsKey   = "groups" // list of consumer groups names
+	logGroupPrefix = "group:" // prefix for committed offset of consumer group
+)
+
+// Persistent append-only log with named consumer groups. Entries are stored like in naive queue (sequence
+// is an offset) with append time. Each group tracks own committed offset in the storage, so several consumers
+// could read the same entries independently. Entries are removed only by retention (see Retain).
+func Log(storage storages.KV) (*logQueue, error) {
+	queue, err := NaiveQueue(storage)
+	if err != nil {
+		return nil, err
+	}
+	lq := &logQueue{
+		queue:  queue,
+		groups: make(map[string]*consumerGroup),
+	}
+	names, err := loadGroups(storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "load consumer groups")
+	}
+	for _, name := range names {
+		committed, err := loadBinaryKey(storage.Get(groupKey(name)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "load offset of group %v", name)
+		}
+		lq.groups[name] = &consumerGroup{
+			log:       lq,
+			name:      name,
+			committed: committed,
+			cursor:    committed + 1,
+		}
+	}
+	return lq, nil
+}
+
+// Entry of log
+type LogEntry struct {
+	Offset uint64    // sequence number in log
+	Time   time.Time // append time
+	Data   []byte
+}
+
+type logQueue struct {
+	queue  *naiveQueue
+	lock   sync.Mutex
+	groups map[string]*consumerGroup
+}
+
+// Append data to the end of log and return offset
+func (lq *logQueue) Append(data []byte) (uint64, error) {
+	var record = make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(record, uint64(time.Now().UnixNano()))
+	copy(record[8:], data)
+	lq.queue.lock.Lock()
+	defer lq.queue.lock.Unlock()
+	return lq.queue.unsafePut(record)
+}
+
+// Read entry by offset. Returns os.ErrNotExist if entry not yet appended or already removed by retention
+func (lq *logQueue) Read(offset uint64) (*LogEntry, error) {
+	lq.queue.lock.RLock()
+	defer lq.queue.lock.RUnlock()
+	return lq.unsafeRead(offset)
+}
+
+// Offsets of the oldest and the latest entries. If log is empty oldest is greater than latest
+func (lq *logQueue) Bounds() (oldest, latest uint64) {
+	lq.queue.lock.RLock()
+	defer lq.queue.lock.RUnlock()
+	return lq.queue.oldestSequence, lq.queue.latestSequence
+}
+
+// Get or create consumer group. New group starts from the oldest entry
+func (lq *logQueue) Group(name string) (*consumerGroup, error) {
+	lq.lock.Lock()
+	defer lq.lock.Unlock()
+	if group, ok := lq.groups[name]; ok {
+		return group, nil
+	}
+	group := &consumerGroup{
+		log:    lq,
+		name:   name,
+		cursor: 1,
+	}
+	lq.groups[name] = group
+	err := lq.unsafeSaveGroups()
+	if err != nil {
+		delete(lq.groups, name)
+		return nil, err
+	}
+	return group, nil
+}
+
+// Names of consumer groups in lexicographical order
+func (lq *logQueue) Groups() []string {
+	lq.lock.Lock()
+	defer lq.lock.Unlock()
+	return lq.unsafeNames()
+}
+
+// Remove consumer group and its committed offset. Entries retained only for this group will be removed by
+// next retention
+func (lq *logQueue) DelGroup(name string) error {
+	lq.lock.Lock()
+	defer lq.lock.Unlock()
+	group, ok := lq.groups[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(lq.groups, name)
+	err := lq.unsafeSaveGroups()
+	if err != nil {
+		lq.groups[name] = group
+		return err
+	}
+	return lq.queue.storage.Del(groupKey(name))
+}
+
+// Remove the oldest entries that are committed by all groups or appended earlier than maxAge ago.
+// Non-positive maxAge disables removing by age. Without groups entries are removed only by age.
+// Returns number of removed entries.
+func (lq *logQueue) Retain(maxAge time.Duration) (int, error) {
+	lq.lock.Lock()
+	var consumed uint64
+	for i, name := range lq.unsafeNames() {
+		committed := lq.groups[name].Committed()
+		if i == 0 || committed < consumed {
+			consumed = committed
+		}
+	}
+	lq.lock.Unlock()
+
+	threshold := time.Now().Add(-maxAge)
+	nq := lq.queue
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+	var removed int
+	for !nq.isEmpty() {
+		if nq.oldestSequence > consumed {
+			if maxAge <= 0 {
+				break
+			}
+			entry, err := lq.unsafeRead(nq.oldestSequence)
+			if err != nil {
+				return removed, err
+			}
+			if !entry.Time.Before(threshold) {
+				break
+			}
+		}
+		err := nq.unsafeDiscard()
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (lq *logQueue) unsafeRead(offset uint64) (*LogEntry, error) {
+	nq := lq.queue
+	if offset < nq.oldestSequence || offset > nq.latestSequence {
+		return nil, os.ErrNotExist
+	}
+	key := nq.getKey(offset)
+	data, err := nq.storage.Get(key[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, errors.Errorf("broken entry %v: required at least 8 bytes", offset)
+	}
+	return &LogEntry{
+		Offset: offset,
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+		Data:   data[8:],
+	}, nil
+}
+
+func (lq *logQueue) unsafeNames() []string {
+	var names = make([]string, 0, len(lq.groups))
+	for name := range lq.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (lq *logQueue) unsafeSaveGroups() error {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(lq.unsafeNames())
+	if err != nil {
+		return err
+	}
+	return lq.queue.storage.Put([]byte(logGroupsKey), buf.Bytes())
+}
+
+// Consumer group of log. Group reads entries from cursor (in-memory position) and commits processed offsets
+// to the storage. After restart reading continues after the committed offset, so delivery is at-least-once.
+// Thread safe: members of the group in one process share cursor.
+type consumerGroup struct {
+	log       *logQueue
+	name      string
+	lock      sync.Mutex
+	committed uint64 // last committed offset (0 - nothing committed)
+	cursor    uint64 // next offset to read
+}
+
+// Name of group
+func (cg *consumerGroup) Name() string { return cg.name }
+
+// Read next entry and move cursor. Entries removed by retention are skipped. Returns os.ErrNotExist if there
+// are no new entries
+func (cg *consumerGroup) Next() (*LogEntry, error) {
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+	oldest, _ := cg.log.Bounds()
+	if cg.cursor < oldest {
+		cg.cursor = oldest
+	}
+	entry, err := cg.log.Read(cg.cursor)
+	if err != nil {
+		return nil, err
+	}
+	cg.cursor++
+	return entry, nil
+}
+
+// Read next entry and move cursor. Blocks until new entry appended or context done
+func (cg *consumerGroup) NextWait(ctx context.Context) (*LogEntry, error) {
+	for {
+		notification := cg.log.queue.notification()
+		entry, err := cg.Next()
+		if err != os.ErrNotExist {
+			return entry, err
+		}
+		err = cg.log.queue.waitData(ctx, notification)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Commit offset as processed and save it to the storage. Cursor will be moved after offset if needed.
+// Offset should not be greater than offset of the latest entry and less than committed offset (committed offset
+// could not be moved backward, use Rewind to deliver not committed entries again), otherwise ErrInvalidOffset returned
+func (cg *consumerGroup) Commit(offset uint64) error {
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+	if _, latest := cg.log.Bounds(); offset > latest {
+		return errors.Wrapf(ErrInvalidOffset, "offset %v is after the latest entry %v", offset, latest)
+	}
+	if offset < cg.committed {
+		return errors.Wrapf(ErrInvalidOffset, "offset %v is before committed offset %v", offset, cg.committed)
+	}
+	key := cg.log.queue.getKey(offset)
+	err := cg.log.queue.storage.Put(groupKey(cg.name), key[:])
+	if err != nil {
+		return err
+	}
+	cg.committed = offset
+	if cg.cursor <= offset {
+		cg.cursor = offset + 1
+	}
+	return nil
+}
+
+// Last committed offset (0 - nothing committed)
+func (cg *consumerGroup) Committed() uint64 {
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+	return cg.committed
+}
+
+// Move cursor back to the first not committed entry to deliver uncommitted entries again
+func (cg *consumerGroup) Rewind() {
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+	cg.cursor = cg.committed + 1
+}
+
+// Number of appended but not committed entries
+func (cg *consumerGroup) Lag() uint64 {
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+	oldest, latest := cg.log.Bounds()
+	from := cg.committed + 1
+	if from < oldest {
+		from = oldest
+	}
+	if from > latest {
+		return 0
+	}
+	return latest - from + 1
+}
+
+func loadGroups(storage storages.KV) ([]string, error) {
+	data, err := storage.Get([]byte(logGroupsKey))
+	if err == os.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	return names, gob.NewDecoder(bytes.NewReader(data)).Decode(&names)
+}
+
+func groupKey(name string) []byte {
+	return []byte(logGroupPrefix + name)
+}
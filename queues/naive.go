@@ -1,16 +1,19 @@
 package queues
 
 import (
+	"context"
 	"encoding/binary"
 	"github.com/pkg/errors"
 	"github.com/reddec/storages"
 	"os"
 	"sync"
+	"time"
 )
 
 const (
 	latestSequenceKey = "latest"
 	oldestSequenceKey = "oldest"
+	deletedCountKey   = "deleted" // number of records removed by DeleteByID after the oldest sequence
 )
 
 // Basic but powerful implementation of queues based on any storage
@@ -24,6 +27,11 @@ func NaiveQueue(storage storages.KV) (*naiveQueue, error) {
 		return nil, errors.Wrap(err, "load latest sequence")
 	}
 
+	deleted, err := loadBinaryKey(storage.Get([]byte(deletedCountKey)))
+	if err != nil {
+		return nil, errors.Wrap(err, "load number of deleted records")
+	}
+
 	if oldest == 0 {
 		oldest = 1
 	}
@@ -36,6 +44,7 @@ func NaiveQueue(storage storages.KV) (*naiveQueue, error) {
 		storage:        storage,
 		latestSequence: latest,
 		oldestSequence: oldest,
+		deleted:        deleted,
 	}, nil
 }
 
@@ -43,27 +52,124 @@ type naiveQueue struct {
 	storage        storages.KV
 	latestSequence uint64 // last used sequence ID (0 means unused).
 	oldestSequence uint64 // oldest used sequence ID (0 means unused)
+	deleted        uint64 // number of records removed by DeleteByID between oldest and latest sequences
 	lock           sync.RWMutex
+	signal         notifier
 }
 
 func (nq *naiveQueue) Put(data []byte) error {
 	nq.lock.Lock()
 	defer nq.lock.Unlock()
+	_, err := nq.unsafePut(data)
+	return err
+}
 
-	num := nq.latestSequence + 1
-	sequenceNum := nq.getKey(num)
-	// save data
-	err := nq.storage.Put(sequenceNum[:], data)
+// Put several data with single update of latest sequence. If storage is storages.BatchedStorage, all data
+// and sequence are written by one batch
+func (nq *naiveQueue) PutBatch(items [][]byte) error {
+	if len(items) == 0 {
+		return nil
+	}
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+
+	var writer storages.Writer = noCloseWriter{nq.storage}
+	if batched, ok := nq.storage.(storages.BatchedStorage); ok {
+		writer = batched.BatchWriter()
+	}
+	num := nq.latestSequence
+	for _, item := range items {
+		num++
+		sequenceNum := nq.getKey(num)
+		err := writer.Put(sequenceNum[:], item)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	latest := nq.getKey(num)
+	err := writer.Put([]byte(latestSequenceKey), latest[:])
 	if err != nil {
+		writer.Close()
 		return err
 	}
-	// save sequence
-	err = nq.unsafeWriteLatestSequence(sequenceNum[:])
+	err = writer.Close()
 	if err != nil {
 		return err
 	}
-	// update cached sequence
 	nq.latestSequence = num
+	nq.unsafeNotify()
+	return nil
+}
+
+// Get at most max oldest data with single update of oldest sequence. If queue is empty - os.ErrNotExist
+func (nq *naiveQueue) GetBatch(max int) ([][]byte, error) {
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+	if nq.isEmpty() || max <= 0 {
+		return nil, os.ErrNotExist
+	}
+	var ans [][]byte
+	var skipped uint64
+	num := nq.oldestSequence
+	for ; num <= nq.latestSequence && len(ans) < max; num++ {
+		key := nq.getKey(num)
+		data, err := nq.storage.Get(key[:])
+		if err == os.ErrNotExist {
+			skipped++ // removed by DeleteByID
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ans = append(ans, data)
+	}
+	if len(ans) == 0 {
+		return nil, os.ErrNotExist
+	}
+	err := nq.unsafeRemoveRange(nq.oldestSequence, num)
+	if err != nil {
+		return nil, err
+	}
+	// records are already consumed: stale counter affects only Len
+	_ = nq.unsafePassDeleted(skipped)
+	return ans, nil
+}
+
+// move oldest sequence to next and remove records before it. If storage is storages.BatchedStorage with
+// storages.BatchDeleter writer, pointer and records are updated by one batch. Otherwise pointer is moved first:
+// interruption leaves orphan records instead of broken queue, so errors of removing records are ignored
+func (nq *naiveQueue) unsafeRemoveRange(from, next uint64) error {
+	nextKey := nq.getKey(next)
+	if batched, ok := nq.storage.(storages.BatchedStorage); ok {
+		batch := batched.BatchWriter()
+		if writer, ok := batch.(storages.BatchDeleter); ok {
+			err := writer.Put([]byte(oldestSequenceKey), nextKey[:])
+			for seq := from; seq < next && err == nil; seq++ {
+				key := nq.getKey(seq)
+				err = writer.Del(key[:])
+			}
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			err = writer.Close()
+			if err != nil {
+				return err
+			}
+			nq.oldestSequence = next
+			return nil
+		}
+		_ = batch.Close() // nothing written
+	}
+	err := nq.unsafeWriteOldestSequence(nextKey[:])
+	if err != nil {
+		return err
+	}
+	nq.oldestSequence = next
+	for seq := from; seq < next; seq++ {
+		key := nq.getKey(seq)
+		_ = nq.storage.Del(key[:])
+	}
 	return nil
 }
 
@@ -85,6 +191,81 @@ func (nq *naiveQueue) Get() ([]byte, error) {
 	return data, nq.unsafeDiscard()
 }
 
+// Get oldest data and remove it. Blocks until data available or context done. Put in the same process wakes
+// waiter immediately. Data from other processes that share the storage is detected by notifications (if storage
+// is storages.Signaller) or by re-reading sequences each DefaultPollInterval.
+func (nq *naiveQueue) GetWait(ctx context.Context) ([]byte, error) {
+	return GetWait(ctx, nq)
+}
+
+// Number of records in queue
+func (nq *naiveQueue) Len() int {
+	nq.lock.RLock()
+	defer nq.lock.RUnlock()
+	return nq.unsafeLen()
+}
+
+// Iterate over records (without removing) starting from id (sequence number) in order of adding. Records
+// removed during iteration are skipped. Handler could access the queue
+func (nq *naiveQueue) Range(fromID uint64, handler func(id uint64, data []byte) error) error {
+	nq.lock.RLock()
+	oldest, latest := nq.oldestSequence, nq.latestSequence
+	nq.lock.RUnlock()
+	if fromID < oldest {
+		fromID = oldest
+	}
+	for id := fromID; id <= latest; id++ {
+		key := nq.getKey(id)
+		data, err := nq.storage.Get(key[:])
+		if err == os.ErrNotExist {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = handler(id, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove all records
+func (nq *naiveQueue) Purge() error {
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+	if nq.isEmpty() {
+		return nil
+	}
+	err := nq.unsafeRemoveRange(nq.oldestSequence, nq.latestSequence+1)
+	if err != nil {
+		return err
+	}
+	return nq.unsafeSetDeleted(0)
+}
+
+// Remove record by id (sequence number). Returns os.ErrNotExist if there is no such record
+func (nq *naiveQueue) DeleteByID(id uint64) error {
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+	if nq.isEmpty() || id < nq.oldestSequence || id > nq.latestSequence {
+		return os.ErrNotExist
+	}
+	key := nq.getKey(id)
+	_, err := nq.storage.Get(key[:])
+	if err != nil {
+		return err
+	}
+	if first, _, _ := nq.unsafeFirst(); first == id {
+		return nq.unsafeDiscard()
+	}
+	err = nq.storage.Del(key[:])
+	if err != nil {
+		return err
+	}
+	return nq.unsafeSetDeleted(nq.deleted + 1)
+}
+
 func (nq *naiveQueue) Discard() error {
 	nq.lock.Lock()
 	defer nq.lock.Unlock()
@@ -92,6 +273,88 @@ func (nq *naiveQueue) Discard() error {
 	return nq.unsafeDiscard()
 }
 
+func (nq *naiveQueue) notification() <-chan struct{} {
+	return nq.signal.notification()
+}
+
+func (nq *naiveQueue) waitData(ctx context.Context, notification <-chan struct{}) error {
+	remote := make(chan struct{})
+	if signaller, ok := nq.storage.(storages.Signaller); ok {
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			if signaller.Wait(waitCtx, []byte(latestSequenceKey)) == nil {
+				close(remote)
+			}
+		}()
+	}
+	timer := time.NewTimer(DefaultPollInterval)
+	defer timer.Stop()
+	select {
+	case <-notification:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-remote:
+	case <-timer.C:
+	}
+	return nq.Reload()
+}
+
+// Reload sequences from storage to detect data added or removed by other processes that share the storage
+func (nq *naiveQueue) Reload() error {
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+	oldest, err := loadBinaryKey(nq.storage.Get([]byte(oldestSequenceKey)))
+	if err != nil {
+		return errors.Wrap(err, "load oldest sequence")
+	}
+	latest, err := loadBinaryKey(nq.storage.Get([]byte(latestSequenceKey)))
+	if err != nil {
+		return errors.Wrap(err, "load latest sequence")
+	}
+	if oldest > nq.oldestSequence {
+		nq.oldestSequence = oldest
+	}
+	if latest > nq.latestSequence {
+		nq.latestSequence = latest
+	}
+	deleted, err := loadBinaryKey(nq.storage.Get([]byte(deletedCountKey)))
+	if err != nil {
+		return errors.Wrap(err, "load number of deleted records")
+	}
+	nq.deleted = deleted
+	return nil
+}
+
+// put data and return used sequence
+func (nq *naiveQueue) unsafePut(data []byte) (uint64, error) {
+	num := nq.latestSequence + 1
+	sequenceNum := nq.getKey(num)
+	// save data
+	err := nq.storage.Put(sequenceNum[:], data)
+	if err != nil {
+		return 0, err
+	}
+	// save sequence
+	err = nq.unsafeWriteLatestSequence(sequenceNum[:])
+	if err != nil {
+		return 0, err
+	}
+	// update cached sequence
+	nq.latestSequence = num
+	nq.unsafeNotify()
+	return num, nil
+}
+
+func (nq *naiveQueue) unsafeNotify() {
+	nq.signal.notify()
+	if signaller, ok := nq.storage.(storages.Signaller); ok {
+		// best effort: waiters in other processes re-check queue by poll interval anyway
+		_ = signaller.Notify([]byte(latestSequenceKey))
+	}
+}
+
 func (nq *naiveQueue) unsafeWriteLatestSequence(currentSequenceID []byte) error {
 	return nq.storage.Put([]byte(latestSequenceKey), currentSequenceID)
 }
@@ -101,41 +364,85 @@ func (nq *naiveQueue) unsafeWriteOldestSequence(currentSequenceID []byte) error
 }
 
 func (nq *naiveQueue) unsafeDiscard() error {
-	if nq.isEmpty() {
-		return os.ErrNotExist
+	num, _, err := nq.unsafeFirst()
+	if err != nil {
+		return err
 	}
-	num := nq.oldestSequence
 	key := nq.getKey(num)
 
-	err := nq.storage.Del(key[:])
+	err = nq.storage.Del(key[:])
 	if err != nil {
 		return err
 	}
 
-	next := nq.oldestSequence + 1
+	next := num + 1
 	sequence := nq.getKey(next)
 	err = nq.unsafeWriteOldestSequence(sequence[:])
 	if err != nil {
 		return err
 	}
 
+	skipped := num - nq.oldestSequence // removed by DeleteByID
 	nq.oldestSequence = next
+	// record is already removed: stale counter affects only Len
+	_ = nq.unsafePassDeleted(skipped)
+	return nil
+}
+
+// oldest sequence passed records removed by DeleteByID
+func (nq *naiveQueue) unsafePassDeleted(count uint64) error {
+	if count > nq.deleted {
+		count = nq.deleted
+	}
+	return nq.unsafeSetDeleted(nq.deleted - count)
+}
+
+func (nq *naiveQueue) unsafeSetDeleted(count uint64) error {
+	if count == nq.deleted {
+		return nil
+	}
+	value := nq.getKey(count)
+	err := nq.storage.Put([]byte(deletedCountKey), value[:])
+	if err != nil {
+		return err
+	}
+	nq.deleted = count
 	return nil
 }
 
 func (nq *naiveQueue) unsafePeek() (data []byte, key [8]byte, err error) {
-	if nq.isEmpty() {
-		err = os.ErrNotExist
+	num, data, err := nq.unsafeFirst()
+	if err != nil {
 		return
 	}
-
-	num := nq.oldestSequence
 	key = nq.getKey(num)
-
-	data, err = nq.storage.Get(key[:])
 	return
 }
 
+// the oldest existing record: records removed by DeleteByID are skipped
+func (nq *naiveQueue) unsafeFirst() (uint64, []byte, error) {
+	for num := nq.oldestSequence; num <= nq.latestSequence; num++ {
+		key := nq.getKey(num)
+		data, err := nq.storage.Get(key[:])
+		if err == os.ErrNotExist {
+			continue
+		}
+		return num, data, err
+	}
+	return 0, nil, os.ErrNotExist
+}
+
+func (nq *naiveQueue) unsafeLen() int {
+	if nq.isEmpty() {
+		return 0
+	}
+	total := nq.latestSequence - nq.oldestSequence + 1
+	if nq.deleted >= total {
+		return 0
+	}
+	return int(total - nq.deleted)
+}
+
 func (nq *naiveQueue) isEmpty() bool {
 	return nq.latestSequence == 0 || nq.oldestSequence > nq.latestSequence
 }
@@ -146,6 +453,13 @@ func (nq *naiveQueue) getKey(num uint64) [8]byte {
 	return sequenceNum
 }
 
+// writer directly to storage without closing it
+type noCloseWriter struct {
+	storages.Writer
+}
+
+func (noCloseWriter) Close() error { return nil }
+
 func loadBinaryKey(data []byte, err error) (uint64, error) {
 	if err == os.ErrNotExist {
 		return 0, nil
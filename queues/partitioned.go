@@ -0,0 +1,195 @@
+package queues
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"hash/crc32"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Partitioned queue over naive queues in each storage. Partitions have independent locks and sequences, so
+// operations on different partitions do not block each other.
+//
+// Put spreads data over partitions by round-robin, PutKey routes data by hash (IEEE CRC-32) of partition key,
+// so data with the same key keeps order. Get, Peek and Discard read partitions by round-robin. Partition of
+// Peek is pinned till next Get or Discard, so they return and remove the peeked data (if it is still there).
+// Order between partitions is not defined.
+func Partitioned(partitions ...storages.KV) (*partitionedQueue, error) {
+	if len(partitions) == 0 {
+		return nil, errors.New("at least one partition required")
+	}
+	var queues = make([]*naiveQueue, len(partitions))
+	for i, storage := range partitions {
+		queue, err := NaiveQueue(storage)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open partition %v", i)
+		}
+		queues[i] = queue
+	}
+	return &partitionedQueue{partitions: queues}, nil
+}
+
+// Partitioned queue with n partitions in namespaces partition-<index> of storage. See Partitioned.
+func PartitionedNamespaces(storage storages.NamespacedStorage, n int) (*partitionedQueue, error) {
+	var partitions = make([]storages.KV, n)
+	for i := range partitions {
+		ns, err := storage.Namespace([]byte("partition-" + strconv.Itoa(i)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "open namespace of partition %v", i)
+		}
+		partitions[i] = ns
+	}
+	return Partitioned(partitions...)
+}
+
+// Partitioned queue with shard of pool as partition in order of pool iteration. Partition key routing is independent
+// of pool routing. See Partitioned.
+func PartitionedPool(pool storages.ShardPool) (*partitionedQueue, error) {
+	var partitions []storages.KV
+	err := pool.Iterate(func(storage storages.Storage) error {
+		partitions = append(partitions, storage)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Partitioned(partitions...)
+}
+
+type partitionedQueue struct {
+	partitions []*naiveQueue
+	putCursor  uint64 // next partition for Put
+	getCursor  uint64 // first partition to read
+	pinned     uint64 // partition of last Peek + 1 (0 means not pinned)
+	signal     notifier
+}
+
+func (pq *partitionedQueue) Put(data []byte) error {
+	idx := (atomic.AddUint64(&pq.putCursor, 1) - 1) % uint64(len(pq.partitions))
+	return pq.put(int(idx), data)
+}
+
+// Put data to partition defined by key. Data with the same key will be read in the same order
+func (pq *partitionedQueue) PutKey(key []byte, data []byte) error {
+	return pq.put(pq.Partition(key), data)
+}
+
+// Index of partition for key
+func (pq *partitionedQueue) Partition(key []byte) int {
+	return int(crc32.ChecksumIEEE(key) % uint32(len(pq.partitions)))
+}
+
+// Number of partitions
+func (pq *partitionedQueue) Partitions() int { return len(pq.partitions) }
+
+func (pq *partitionedQueue) Peek() ([]byte, error) {
+	var ans []byte
+	idx, err := pq.read(func(queue *naiveQueue) (err error) {
+		ans, err = queue.Peek()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreUint64(&pq.pinned, uint64(idx)+1)
+	return ans, nil
+}
+
+func (pq *partitionedQueue) Get() ([]byte, error) {
+	var ans []byte
+	idx, err := pq.read(func(queue *naiveQueue) (err error) {
+		ans, err = queue.Get()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	pq.moveCursor(idx)
+	return ans, nil
+}
+
+func (pq *partitionedQueue) Discard() error {
+	idx, err := pq.read(func(queue *naiveQueue) error {
+		return queue.Discard()
+	})
+	if err != nil {
+		return err
+	}
+	pq.moveCursor(idx)
+	return nil
+}
+
+// Get data by round-robin and remove it. Blocks until data available or context done
+func (pq *partitionedQueue) GetWait(ctx context.Context) ([]byte, error) {
+	return GetWait(ctx, pq)
+}
+
+// Total number of records in all partitions
+func (pq *partitionedQueue) Len() int {
+	var total int
+	for _, queue := range pq.partitions {
+		total += queue.Len()
+	}
+	return total
+}
+
+func (pq *partitionedQueue) notification() <-chan struct{} {
+	return pq.signal.notification()
+}
+
+func (pq *partitionedQueue) waitData(ctx context.Context, notification <-chan struct{}) error {
+	timer := time.NewTimer(DefaultPollInterval)
+	defer timer.Stop()
+	select {
+	case <-notification:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	// detect data from other processes
+	for i, queue := range pq.partitions {
+		err := queue.Reload()
+		if err != nil {
+			return errors.Wrapf(err, "reload partition %v", i)
+		}
+	}
+	return nil
+}
+
+func (pq *partitionedQueue) put(idx int, data []byte) error {
+	err := pq.partitions[idx].Put(data)
+	if err != nil {
+		return err
+	}
+	pq.signal.notify()
+	return nil
+}
+
+// apply operation to partitions starting from pinned partition (or read cursor) till first partition with data
+func (pq *partitionedQueue) read(operation func(queue *naiveQueue) error) (int, error) {
+	n := uint64(len(pq.partitions))
+	start := atomic.LoadUint64(&pq.getCursor)
+	if pinned := atomic.LoadUint64(&pq.pinned); pinned != 0 {
+		start = pinned - 1
+	}
+	for i := uint64(0); i < n; i++ {
+		idx := int((start + i) % n)
+		err := operation(pq.partitions[idx])
+		if err == os.ErrNotExist {
+			continue
+		}
+		return idx, err
+	}
+	return 0, os.ErrNotExist
+}
+
+// next read starts after partition, pinned partition is released
+func (pq *partitionedQueue) moveCursor(idx int) {
+	atomic.StoreUint64(&pq.pinned, 0)
+	atomic.StoreUint64(&pq.getCursor, uint64(idx+1)%uint64(len(pq.partitions)))
+}
@@ -0,0 +1,245 @@
+package queues
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errNoSignals = errors.New("storage does not support notifications")
+
+// Priority queue with defined number of levels: 0 is the lowest priority, levels-1 is the highest.
+// Weight of each level is priority+1. See PriorityWeighted for details.
+func Priority(storage storages.KV, levels int) (*priorityQueue, error) {
+	var weights = make([]int, levels)
+	for i := range weights {
+		weights[i] = i + 1
+	}
+	return PriorityWeighted(storage, weights)
+}
+
+// Priority queue with custom weights of levels: index of weight is a priority. Each level is a naive queue
+// stored in namespace of storage (if storage is NamespacedStorage) or under prefixed keys.
+//
+// Records are dequeued by smooth weighted round-robin over non-empty levels: the level with weight W gets
+// W/sum(weights of non-empty levels) part of reads, so low priority records are not starved. Records in
+// one level are in FIFO order. Put uses the lowest priority (0).
+//
+// GetWait detects records added by other processes like naive queue: by notifications of level storages
+// (if they are storages.Signaller) or by re-reading levels each DefaultPollInterval.
+func PriorityWeighted(storage storages.KV, weights []int) (*priorityQueue, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("at least one priority level required")
+	}
+	var levels = make([]*naiveQueue, len(weights))
+	for i, weight := range weights {
+		if weight <= 0 {
+			return nil, errors.Errorf("weight of priority %v should be positive", i)
+		}
+		kv, err := levelStorage(storage, i)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open storage for priority %v", i)
+		}
+		queue, err := NaiveQueue(kv)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open queue for priority %v", i)
+		}
+		levels[i] = queue
+	}
+	return &priorityQueue{
+		levels:  levels,
+		weights: weights,
+		current: make([]int, len(weights)),
+	}, nil
+}
+
+type priorityQueue struct {
+	levels  []*naiveQueue
+	weights []int
+	current []int // current weights of smooth weighted round-robin
+	lock    sync.Mutex
+	signal  notifier
+}
+
+func (pq *priorityQueue) Put(data []byte) error {
+	return pq.PutPriority(data, 0)
+}
+
+func (pq *priorityQueue) PutPriority(data []byte, priority int) error {
+	if priority < 0 || priority >= len(pq.levels) {
+		return errors.Errorf("priority %v out of range [0, %v)", priority, len(pq.levels))
+	}
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	err := pq.levels[priority].Put(data)
+	if err != nil {
+		return err
+	}
+	pq.signal.notify()
+	return nil
+}
+
+// Get data by weighted round-robin and remove it. Blocks until data available or context done
+func (pq *priorityQueue) GetWait(ctx context.Context) ([]byte, error) {
+	return GetWait(ctx, pq)
+}
+
+func (pq *priorityQueue) notification() <-chan struct{} {
+	return pq.signal.notification()
+}
+
+// wait for Put in the same process, notification of any level from other processes (if storage of level is
+// storages.Signaller) or DefaultPollInterval, then reload levels to detect data added by other processes
+func (pq *priorityQueue) waitData(ctx context.Context, notification <-chan struct{}) error {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	remote := make(chan struct{}, len(pq.levels))
+	for _, level := range pq.levels {
+		if signaller, ok := level.storage.(storages.Signaller); ok {
+			go func(signaller storages.Signaller) {
+				if signaller.Wait(waitCtx, []byte(latestSequenceKey)) == nil {
+					remote <- struct{}{}
+				}
+			}(signaller)
+		}
+	}
+	timer := time.NewTimer(DefaultPollInterval)
+	defer timer.Stop()
+	select {
+	case <-notification:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-remote:
+	case <-timer.C:
+	}
+	return pq.Reload()
+}
+
+// Reload sequences of all levels from storage to detect data added or removed by other processes
+func (pq *priorityQueue) Reload() error {
+	for i, level := range pq.levels {
+		err := level.Reload()
+		if err != nil {
+			return errors.Wrapf(err, "reload priority %v", i)
+		}
+	}
+	return nil
+}
+
+func (pq *priorityQueue) Peek() ([]byte, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	level, _ := pq.next()
+	if level == -1 {
+		return nil, os.ErrNotExist
+	}
+	return pq.levels[level].Peek()
+}
+
+func (pq *priorityQueue) Discard() error {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	level, current := pq.next()
+	if level == -1 {
+		return os.ErrNotExist
+	}
+	err := pq.levels[level].Discard()
+	if err != nil {
+		return err
+	}
+	pq.current = current
+	return nil
+}
+
+func (pq *priorityQueue) Get() ([]byte, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	level, current := pq.next()
+	if level == -1 {
+		return nil, os.ErrNotExist
+	}
+	data, err := pq.levels[level].Get()
+	if err != nil {
+		return nil, err
+	}
+	pq.current = current
+	return data, nil
+}
+
+// select next level by smooth weighted round-robin over non-empty levels without changing state.
+// Returns -1 if all levels are empty
+func (pq *priorityQueue) next() (int, []int) {
+	var current = make([]int, len(pq.current))
+	copy(current, pq.current)
+	var total int
+	var selected = -1
+	// iterate from the highest priority so it wins on equal weights
+	for i := len(pq.levels) - 1; i >= 0; i-- {
+		// sequences of level could be updated by reload
+		level := pq.levels[i]
+		level.lock.RLock()
+		empty := level.isEmpty()
+		level.lock.RUnlock()
+		if empty {
+			continue
+		}
+		current[i] += pq.weights[i]
+		total += pq.weights[i]
+		if selected == -1 || current[i] > current[selected] {
+			selected = i
+		}
+	}
+	if selected != -1 {
+		current[selected] -= total
+	}
+	return selected, current
+}
+
+func levelStorage(storage storages.KV, level int) (storages.KV, error) {
+	name := "priority-" + strconv.Itoa(level)
+	if ns, ok := storage.(storages.NamespacedStorage); ok {
+		return ns.Namespace([]byte(name))
+	}
+	return &prefixedKV{kv: storage, prefix: []byte(name + ":")}, nil
+}
+
+// KV with prefixed keys
+type prefixedKV struct {
+	kv     storages.KV
+	prefix []byte
+}
+
+func (pk *prefixedKV) Put(key []byte, data []byte) error { return pk.kv.Put(pk.key(key), data) }
+func (pk *prefixedKV) Get(key []byte) ([]byte, error)    { return pk.kv.Get(pk.key(key)) }
+func (pk *prefixedKV) Del(key []byte) error              { return pk.kv.Del(pk.key(key)) }
+func (pk *prefixedKV) Close() error                      { return nil }
+
+// Notify waiters of prefixed key if underlying storage is storages.Signaller
+func (pk *prefixedKV) Notify(key []byte) error {
+	signaller, ok := pk.kv.(storages.Signaller)
+	if !ok {
+		return errNoSignals
+	}
+	return signaller.Notify(pk.key(key))
+}
+
+// Wait notification of prefixed key if underlying storage is storages.Signaller
+func (pk *prefixedKV) Wait(ctx context.Context, key []byte) error {
+	signaller, ok := pk.kv.(storages.Signaller)
+	if !ok {
+		return errNoSignals
+	}
+	return signaller.Wait(ctx, pk.key(key))
+}
+
+func (pk *prefixedKV) key(key []byte) []byte {
+	var ans = make([]byte, len(pk.prefix)+len(key))
+	copy(ans, pk.prefix)
+	copy(ans[len(pk.prefix):], key)
+	return ans
+}
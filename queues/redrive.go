@@ -0,0 +1,31 @@
+package queues
+
+import (
+	"github.com/reddec/storages"
+	"os"
+)
+
+// Move up to limit records (all if limit is not positive) from one queue (like dead-letter queue) to another
+// in FIFO order. Records are put to the target queue before removing from source, so failure may cause duplicates
+// but not losses. Returns number of moved records.
+func Redrive(from, to storages.Queue, limit int) (int, error) {
+	var moved int
+	for limit <= 0 || moved < limit {
+		data, err := from.Peek()
+		if err == os.ErrNotExist {
+			break
+		} else if err != nil {
+			return moved, err
+		}
+		err = to.Put(data)
+		if err != nil {
+			return moved, err
+		}
+		err = from.Discard()
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
@@ -0,0 +1,305 @@
+package queues
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"os"
+	"time"
+)
+
+const (
+	inflightOldestKey   = "inflight-oldest" // the lowest id of reserved records
+	inflightDataPrefix  = "inflight:"       // prefix for data of reserved records
+	inflightStatePrefix = "inflight-state:" // prefix for deadline and attempts of reserved records
+)
+
+// Reliable queue based on naive queue in the same storage. Reserved records are moved to in-flight area
+// of the storage and returned back to the queue after visibility timeout or negative acknowledge. In-flight
+// state is kept in the storage (separate keys for each record), so it survives restarts.
+//
+// Returned records are delivered before new records. Len, Range and Purge cover only queued records: reserved
+// records are counted by InFlight and removed by Ack (or dead-letter policy).
+func Reliable(storage storages.KV) (*reliableQueue, error) {
+	queue, err := NaiveQueue(storage)
+	if err != nil {
+		return nil, err
+	}
+	inflight, err := loadInflight(storage, queue.oldestSequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "load in-flight records")
+	}
+	return &reliableQueue{
+		naiveQueue: queue,
+		inflight:   inflight,
+	}, nil
+}
+
+type inflightItem struct {
+	ID       uint64 // sequence id of record
+	Deadline int64  // visibility deadline in unix nanoseconds
+	Attempts int    // number of deliveries
+}
+
+type reliableQueue struct {
+	*naiveQueue
+	inflight    []inflightItem // ordered by id
+	maxAttempts int            // 0 means unlimited
+	deadLetter  storages.Queue // optional queue for records that reached max attempts
+}
+
+// Limit number of deliveries for each record. Records that failed (not acknowledged) maxAttempts times
+// will be moved to dead-letter queue during next reservation. If dead-letter queue is nil, such records
+// will be dropped. Non-positive maxAttempts means unlimited deliveries. Should be called before usage.
+func (rq *reliableQueue) WithDeadLetter(maxAttempts int, deadLetter storages.Queue) *reliableQueue {
+	rq.maxAttempts = maxAttempts
+	rq.deadLetter = deadLetter
+	return rq
+}
+
+func (rq *reliableQueue) Reserve(timeout time.Duration) (uint64, []byte, error) {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+	now := time.Now()
+	deadline := now.Add(timeout).UnixNano()
+	// returned records first
+	for i := 0; i < len(rq.inflight); i++ {
+		item := rq.inflight[i]
+		if item.Deadline > now.UnixNano() {
+			continue
+		}
+		data, err := rq.storage.Get(inflightKey(item.ID))
+		if err != nil {
+			return 0, nil, err
+		}
+		if rq.maxAttempts > 0 && item.Attempts >= rq.maxAttempts {
+			err = rq.unsafeBury(i, data)
+			if err != nil {
+				return 0, nil, errors.Wrapf(err, "move record %v to dead-letter queue", item.ID)
+			}
+			i--
+			continue
+		}
+		item.Deadline = deadline
+		item.Attempts++
+		err = rq.unsafeSaveState(item)
+		if err != nil {
+			return 0, nil, err
+		}
+		rq.inflight[i] = item
+		return item.ID, data, nil
+	}
+
+	data, key, err := rq.unsafePeek()
+	if err != nil {
+		return 0, nil, err
+	}
+	id := binary.BigEndian.Uint64(key[:])
+	err = rq.storage.Put(inflightKey(id), data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rq.inflight) == 0 {
+		// records are reserved in order of ids, so only the first reserved record moves the lowest id
+		err = rq.storage.Put([]byte(inflightOldestKey), key[:])
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	item := inflightItem{ID: id, Deadline: deadline, Attempts: 1}
+	err = rq.unsafeSaveState(item)
+	if err != nil {
+		return 0, nil, err
+	}
+	rq.inflight = append(rq.inflight, item)
+	return id, data, rq.unsafeDiscard()
+}
+
+// Reserve oldest data like Reserve but blocks until data available (including returned records) or context done
+func (rq *reliableQueue) ReserveWait(ctx context.Context, timeout time.Duration) (uint64, []byte, error) {
+	for {
+		notification := rq.notification()
+		id, data, err := rq.Reserve(timeout)
+		if err != os.ErrNotExist {
+			return id, data, err
+		}
+		// wake up on the nearest expiration of reservation
+		waitCtx, cancel := context.WithCancel(ctx)
+		if deadline, ok := rq.nextDeadline(); ok {
+			cancel()
+			waitCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		err = rq.waitData(waitCtx, notification)
+		cancel()
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		} else if err != nil && err != context.DeadlineExceeded {
+			return 0, nil, err
+		}
+	}
+}
+
+// the nearest visibility deadline of reserved records
+func (rq *reliableQueue) nextDeadline() (time.Time, bool) {
+	rq.lock.RLock()
+	defer rq.lock.RUnlock()
+	if len(rq.inflight) == 0 {
+		return time.Time{}, false
+	}
+	nearest := rq.inflight[0].Deadline
+	for _, item := range rq.inflight[1:] {
+		if item.Deadline < nearest {
+			nearest = item.Deadline
+		}
+	}
+	return time.Unix(0, nearest), true
+}
+
+// Number of deliveries of reserved record. Returns os.ErrNotExists if record not reserved
+func (rq *reliableQueue) Attempts(id uint64) (int, error) {
+	rq.lock.RLock()
+	defer rq.lock.RUnlock()
+	idx := rq.indexOf(id)
+	if idx == -1 {
+		return 0, os.ErrNotExist
+	}
+	return rq.inflight[idx].Attempts, nil
+}
+
+func (rq *reliableQueue) Ack(id uint64) error {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+	idx := rq.indexOf(id)
+	if idx == -1 {
+		return os.ErrNotExist
+	}
+	return rq.unsafeRemove(idx)
+}
+
+func (rq *reliableQueue) Nack(id uint64) error {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+	idx := rq.indexOf(id)
+	if idx == -1 {
+		return os.ErrNotExist
+	}
+	item := rq.inflight[idx]
+	item.Deadline = 0
+	err := rq.unsafeSaveState(item)
+	if err != nil {
+		return err
+	}
+	rq.inflight[idx] = item
+	rq.signal.notify()
+	return nil
+}
+
+// Number of reserved (in-flight) records
+func (rq *reliableQueue) InFlight() int {
+	rq.lock.RLock()
+	defer rq.lock.RUnlock()
+	return len(rq.inflight)
+}
+
+// move in-flight record to dead-letter queue (if defined) and remove it
+func (rq *reliableQueue) unsafeBury(idx int, data []byte) error {
+	if rq.deadLetter != nil {
+		err := rq.deadLetter.Put(data)
+		if err != nil {
+			return err
+		}
+	}
+	return rq.unsafeRemove(idx)
+}
+
+func (rq *reliableQueue) unsafeRemove(idx int) error {
+	id := rq.inflight[idx].ID
+	if idx == 0 && len(rq.inflight) > 1 {
+		// move the lowest id before removing, so interruption leaves orphan keys instead of lost records
+		next := rq.getKey(rq.inflight[1].ID)
+		err := rq.storage.Put([]byte(inflightOldestKey), next[:])
+		if err != nil {
+			return err
+		}
+	}
+	err := rq.storage.Del(inflightStateKey(id))
+	if err != nil {
+		return err
+	}
+	rq.inflight = append(rq.inflight[:idx:idx], rq.inflight[idx+1:]...)
+	err = rq.storage.Del(inflightKey(id))
+	if err != nil {
+		return err
+	}
+	if len(rq.inflight) == 0 {
+		// nothing to scan during load
+		err = rq.storage.Del([]byte(inflightOldestKey))
+		if err == os.ErrNotExist {
+			return nil
+		}
+	}
+	return err
+}
+
+func (rq *reliableQueue) indexOf(id uint64) int {
+	for i, item := range rq.inflight {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (rq *reliableQueue) unsafeSaveState(item inflightItem) error {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(item)
+	if err != nil {
+		return err
+	}
+	return rq.storage.Put(inflightStateKey(item.ID), buf.Bytes())
+}
+
+// load states of reserved records: ids between the lowest reserved id and the oldest id in queue are checked
+func loadInflight(storage storages.KV, queueOldest uint64) ([]inflightItem, error) {
+	oldest, err := loadBinaryKey(storage.Get([]byte(inflightOldestKey)))
+	if err != nil {
+		return nil, errors.Wrap(err, "load lowest id")
+	}
+	if oldest == 0 {
+		return nil, nil
+	}
+	var items []inflightItem
+	for id := oldest; id < queueOldest; id++ {
+		data, err := storage.Get(inflightStateKey(id))
+		if err == os.ErrNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var item inflightItem
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode state of %v", id)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func inflightKey(id uint64) []byte {
+	return prefixedID(inflightDataPrefix, id)
+}
+
+func inflightStateKey(id uint64) []byte {
+	return prefixedID(inflightStatePrefix, id)
+}
+
+func prefixedID(prefix string, id uint64) []byte {
+	var key = make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], id)
+	return key
+}
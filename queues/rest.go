@@ -1,53 +1,418 @@
 package queues
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/reddec/storages"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Creates new http handler and provides REST-like access to queue.
 //
 // GET / - peek last message in queue (404 NotFound if queue is empty)
 //
-// POST,PUT / - add message to queue
+// POST,PUT / - add message to queue. If queue is storages.DelayedQueue, delivery could be scheduled by X-Delay header
+// (duration like 10m) or by X-Deliver-At header (RFC3339 time). Batch of messages could be added by JSON array
+// (Content-Type: application/json, each string element is an unquoted message, other elements are messages as-is;
+// other JSON values are single messages) or by newline-delimited messages (Content-Type: application/x-ndjson, each
+// non-empty line is a message). If queue is full, 429 returned
 //
 // DELETE / - get last message from queue and remove it. Last message will be returned otherwise 404 not found
+//
+// GET and DELETE support long-polling by wait query parameter (like /?wait=30s): request is blocked until data
+// available or wait interval passed (404 not found)
+//
+// Other paths (including endpoints below if queue does not support them) return 404 not found.
+//
+// If queue is storages.ReliableQueue additional endpoints are available:
+//
+// POST /reserve?timeout=30s - reserve last message. Message will be returned with ID in X-Message-Id header
+// (and number of deliveries in X-Delivery-Attempt if supported) otherwise 404 not found. Default timeout is 30s
+//
+// POST /ack/:id - acknowledge reserved message. Returns 204 on success or 404 if message not reserved
+//
+// POST /nack/:id - return reserved message to the queue. Returns 204 on success or 404 if message not reserved
+//
+// If queue is storages.BrowsableQueue additional endpoints are available:
+//
+// GET /stats - statistics of queue as JSON object: {"length": 10}
+//
+// GET /messages?from=1&limit=100 - messages without removing as JSON array: [{"id": 1, "data": "<base64>"}].
+// Default limit is 100
+//
+// DELETE /messages/:id - remove message by ID. Returns 204 on success or 404 if message not exists
+//
+// POST /purge - remove all messages. Returns 204 on success
 func NewServer(q storages.Queue) http.Handler {
 	mux := http.NewServeMux()
+	if rq, ok := q.(storages.ReliableQueue); ok {
+		handleReliable(mux, rq)
+	}
+	if bq, ok := q.(storages.BrowsableQueue); ok {
+		handleBrowsable(mux, bq)
+	}
 	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
 		defer request.Body.Close()
+		if request.URL.Path != "/" {
+			// endpoints of not supported features (like /reserve) should not enqueue data
+			http.NotFound(writer, request)
+			return
+		}
 
 		switch request.Method {
 		case http.MethodGet: // peek last
-			data, err := q.Peek()
+			data, err := read(q, request, q.Peek, PeekWait)
 			reply(data, err, request, writer)
 		case http.MethodPost, http.MethodPut: // push to queue
-			data, err := ioutil.ReadAll(request.Body)
+			items, err := readBatch(request)
 			if err != nil {
 				http.Error(writer, err.Error(), http.StatusBadRequest)
 				return
 			}
-			err = q.Put(data)
+			status, err := putBatch(q, items, request)
 			if err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				http.Error(writer, err.Error(), status)
 				return
 			}
 			writer.WriteHeader(http.StatusNoContent)
 		case http.MethodDelete: // get last and discard
-			data, err := q.Get()
+			data, err := read(q, request, q.Get, GetWait)
 			reply(data, err, request, writer)
 		}
 	})
 	return mux
 }
 
+// read data from queue immediately or with waiting if wait query parameter defined
+func read(q storages.Queue, request *http.Request,
+	immediate func() ([]byte, error),
+	wait func(ctx context.Context, q storages.Queue) ([]byte, error)) ([]byte, error) {
+	interval := request.URL.Query().Get("wait")
+	if interval == "" {
+		return immediate()
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, badRequest{err}
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), duration)
+	defer cancel()
+	data, err := wait(ctx, q)
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return nil, os.ErrNotExist
+	}
+	return data, err
+}
+
+type badRequest struct {
+	error
+}
+
+// Headers for scheduled delivery (delayed queues)
+const (
+	DelayHeader     = "X-Delay"      // delay in Go duration format (like 1h10m)
+	DeliverAtHeader = "X-Deliver-At" // time in RFC3339 format
+)
+
+// Content types of batches
+const (
+	JSONContentType   = "application/json"     // JSON array of messages (other JSON values are single messages)
+	NDJSONContentType = "application/x-ndjson" // newline-delimited messages
+)
+
+// read messages from request body: batch by content type or whole body as single message
+func readBatch(request *http.Request) ([][]byte, error) {
+	contentType := strings.TrimSpace(strings.Split(request.Header.Get("Content-Type"), ";")[0])
+	switch contentType {
+	case JSONContentType:
+		data, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+			return [][]byte{data}, nil // single JSON value (object, string and so on) is one message
+		}
+		var items []json.RawMessage
+		err = json.Unmarshal(data, &items)
+		if err != nil {
+			return nil, err
+		}
+		var ans = make([][]byte, len(items))
+		for i, item := range items {
+			if len(item) == 0 || item[0] != '"' {
+				ans[i] = item // objects, arrays and other values as-is
+				continue
+			}
+			var text string
+			err = json.Unmarshal(item, &text)
+			if err != nil {
+				return nil, err
+			}
+			ans[i] = []byte(text)
+		}
+		return ans, nil
+	case NDJSONContentType:
+		var ans [][]byte
+		scanner := bufio.NewScanner(request.Body)
+		scanner.Buffer(nil, maxLineSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			ans = append(ans, append([]byte{}, line...))
+		}
+		return ans, scanner.Err()
+	default:
+		data, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{data}, nil
+	}
+}
+
+// maximum size of line in newline-delimited batch
+const maxLineSize = 16 * 1024 * 1024
+
+// put several data to queue with optional scheduling and return HTTP status in case of error. Queues that can
+// wait for space get data one by one with request context
+func putBatch(q storages.Queue, items [][]byte, request *http.Request) (int, error) {
+	_, waiting := q.(contextPutter)
+	if waiting || len(items) == 1 || request.Header.Get(DelayHeader) != "" || request.Header.Get(DeliverAtHeader) != "" {
+		for _, item := range items {
+			status, err := put(q, item, request)
+			if err != nil {
+				return status, err
+			}
+		}
+		return http.StatusNoContent, nil
+	}
+	return putStatus(PutBatch(q, items))
+}
+
+// queue that can wait for space (like bounded queue)
+type contextPutter interface {
+	PutWait(ctx context.Context, data []byte) error
+}
+
+func putStatus(err error) (int, error) {
+	if err == ErrQueueFull {
+		return http.StatusTooManyRequests, err
+	}
+	return http.StatusInternalServerError, err
+}
+
+// put data to queue with optional scheduling and return HTTP status in case of error
+func put(q storages.Queue, data []byte, request *http.Request) (int, error) {
+	delay := request.Header.Get(DelayHeader)
+	deliverAt := request.Header.Get(DeliverAtHeader)
+	if delay == "" && deliverAt == "" {
+		if bq, ok := q.(contextPutter); ok {
+			return putStatus(bq.PutWait(request.Context(), data))
+		}
+		return putStatus(q.Put(data))
+	}
+	dq, ok := q.(storages.DelayedQueue)
+	if !ok {
+		return http.StatusBadRequest, errors.New("queue does not support scheduled delivery")
+	}
+	if delay != "" {
+		duration, err := time.ParseDuration(delay)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusInternalServerError, dq.PutAfter(data, duration)
+	}
+	at, err := time.Parse(time.RFC3339, deliverAt)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusInternalServerError, dq.PutAt(data, at)
+}
+
+// Header with message ID for reliable queues
+const MessageIDHeader = "X-Message-Id"
+
+// Header with number of deliveries of message for reliable queues that support attempts counting
+const DeliveryAttemptHeader = "X-Delivery-Attempt"
+
+type attemptsCounter interface {
+	Attempts(id uint64) (int, error)
+}
+
+// Default visibility timeout for reserved messages over REST
+const DefaultReserveTimeout = 30 * time.Second
+
+func handleReliable(mux *http.ServeMux, q storages.ReliableQueue) {
+	mux.HandleFunc("/reserve", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodPost {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		var timeout = DefaultReserveTimeout
+		if v := request.URL.Query().Get("timeout"); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			timeout = parsed
+		}
+		id, data, err := q.Reserve(timeout)
+		if err == nil {
+			writer.Header().Set(MessageIDHeader, strconv.FormatUint(id, 10))
+			if counter, ok := q.(attemptsCounter); ok {
+				if attempts, err := counter.Attempts(id); err == nil {
+					writer.Header().Set(DeliveryAttemptHeader, strconv.Itoa(attempts))
+				}
+			}
+		}
+		reply(data, err, request, writer)
+	})
+	handleID := func(path string, operation func(id uint64) error) {
+		mux.HandleFunc(path, func(writer http.ResponseWriter, request *http.Request) {
+			defer request.Body.Close()
+			if request.Method != http.MethodPost {
+				http.Error(writer, "no method", http.StatusMethodNotAllowed)
+				return
+			}
+			id, err := strconv.ParseUint(strings.TrimPrefix(request.URL.Path, path), 10, 64)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = operation(id)
+			if err == os.ErrNotExist {
+				http.NotFound(writer, request)
+				return
+			} else if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+	handleID("/ack/", q.Ack)
+	handleID("/nack/", q.Nack)
+}
+
+// Default number of messages returned by GET /messages
+const DefaultBrowseLimit = 100
+
+// Message of queue with ID
+type Message struct {
+	ID   uint64 `json:"id"`
+	Data []byte `json:"data"`
+}
+
+// Statistics of queue
+type Stats struct {
+	Length int `json:"length"`
+}
+
+var errLimitReached = errors.New("limit reached")
+
+func handleBrowsable(mux *http.ServeMux, q storages.BrowsableQueue) {
+	mux.HandleFunc("/stats", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodGet {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(Stats{Length: q.Len()})
+	})
+	mux.HandleFunc("/messages", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodGet {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		var from uint64
+		var limit = DefaultBrowseLimit
+		var err error
+		if v := request.URL.Query().Get("from"); v != "" {
+			from, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := request.URL.Query().Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var messages = make([]Message, 0)
+		err = q.Range(from, func(id uint64, data []byte) error {
+			if len(messages) >= limit {
+				return errLimitReached
+			}
+			messages = append(messages, Message{ID: id, Data: data})
+			return nil
+		})
+		if err != nil && err != errLimitReached {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(messages)
+	})
+	mux.HandleFunc("/messages/", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodDelete {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(request.URL.Path, "/messages/"), 10, 64)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = q.DeleteByID(id)
+		if err == os.ErrNotExist {
+			http.NotFound(writer, request)
+			return
+		} else if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/purge", func(writer http.ResponseWriter, request *http.Request) {
+		defer request.Body.Close()
+		if request.Method != http.MethodPost {
+			http.Error(writer, "no method", http.StatusMethodNotAllowed)
+			return
+		}
+		err := q.Purge()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+}
+
 func reply(data []byte, err error, request *http.Request, writer http.ResponseWriter) {
 	if err == os.ErrNotExist {
 		http.NotFound(writer, request)
 		return
+	} else if _, ok := err.(badRequest); ok {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
 	} else if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
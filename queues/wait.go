@@ -0,0 +1,88 @@
+package queues
+
+import (
+	"context"
+	"github.com/reddec/storages"
+	"os"
+	"sync"
+	"time"
+)
+
+// Interval to re-check queue state if no notification received
+const DefaultPollInterval = time.Second
+
+// Get oldest data from queue and remove it. Blocks until data available or context done. Queues from this package
+// are notified by Put in the same process, other queues are polled with DefaultPollInterval.
+func GetWait(ctx context.Context, queue storages.Queue) ([]byte, error) {
+	return waitFor(ctx, queue, queue.Get)
+}
+
+// Get oldest data from queue but not remove it. Blocks until data available or context done. See GetWait.
+func PeekWait(ctx context.Context, queue storages.Queue) ([]byte, error) {
+	return waitFor(ctx, queue, queue.Peek)
+}
+
+// queue that can wait for new data
+type waiter interface {
+	// channel that will be closed on next put. Should be obtained before checking queue
+	notification() <-chan struct{}
+	// wait for notification, context done or implementation specific event (data may be available)
+	waitData(ctx context.Context, notification <-chan struct{}) error
+}
+
+func waitFor(ctx context.Context, queue storages.Queue, read func() ([]byte, error)) ([]byte, error) {
+	w, _ := queue.(waiter)
+	for {
+		var notification <-chan struct{}
+		if w != nil {
+			notification = w.notification()
+		}
+		data, err := read()
+		if err != os.ErrNotExist {
+			return data, err
+		}
+		if w != nil {
+			err = w.waitData(ctx, notification)
+		} else {
+			err = sleep(ctx, DefaultPollInterval)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// broadcast notification for waiters in the same process. Zero value is ready to use
+type notifier struct {
+	lock sync.Mutex
+	ch   chan struct{}
+}
+
+func (n *notifier) notification() <-chan struct{} {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+func (n *notifier) notify() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Distributed writer strategy
@@ -14,45 +15,104 @@ type DWriter func(key, data []byte, storages []Storage) error
 type DReader func(key []byte, storages []Storage) ([]byte, error)
 
 // Redundant storage that writes values to all back storages and read from first successful.
-func RedundantAll(keysDeduplication Dedup, back ...Storage) *redundant {
+func RedundantAll(keysDeduplication Dedup, back ...Storage) RedundantStorage {
 	return Redundant(AtLeast(len(back)), First(), keysDeduplication, back...)
 }
 
-// Redundant storage with custom strategy for writing and reading backed by several storage
-func Redundant(writer DWriter, reader DReader, keysDeduplication Dedup, back ...Storage) *redundant {
-	return &redundant{
+// Redundant storage with custom strategy for writing and reading backed by several storage.
+//
+// Storage implements NamespacedStorage only if all backend storages are NamespacedStorage. Namespace is a redundant
+// storage over namespaces of backend storages with the same strategies, deduplication and health checking.
+// Namespaces and DelNamespace fan out to all storages.
+func Redundant(writer DWriter, reader DReader, keysDeduplication Dedup, back ...Storage) RedundantStorage {
+	dt := &redundantStorage{
 		backed:            back,
 		writer:            writer,
 		reader:            reader,
 		keysDeduplication: keysDeduplication,
+		iterationLock:     &sync.Mutex{},
 	}
+	return dt.wrap()
 }
 
-type redundant struct {
+// Redundant storage over several backend storages (see Redundant)
+type RedundantStorage interface {
+	Storage
+	HealthReporter
+	// Iterate keys over storages concurrently with at most concurrency storages at a time (non-positive means
+	// all storages at once). Handler invocations are serialized, first error cancels iteration.
+	// See ParallelKeys for details. Should be called before usage.
+	WithParallelKeys(concurrency int) RedundantStorage
+	// Enable periodic health checking of backend storages. Unhealthy storages are excluded from read, write and
+	// iteration operations till next successful check. If there is no healthy storages at all, all storages will be
+	// used. Excluded storages are not written, so write strategy fails if it requires more storages than healthy
+	// (like RedundantAll). Del and DelNamespace are always applied to all storages.
+	//
+	// Checks of storages run concurrently; check that takes longer than interval marks storage as unhealthy.
+	// Previous health checking (if enabled) will be stopped. Should be called before usage.
+	WithHealthCheck(interval time.Duration, check HealthCheck) RedundantStorage
+}
+
+type redundantStorage struct {
 	backed            []Storage // storages for data
 	keysDeduplication Dedup     // used for deduplication during iteration
 	writer            DWriter
 	reader            DReader
-	iterationLock     sync.Mutex
+	iterationLock     *sync.Mutex    // shared with namespaces due to shared deduplication
+	health            *healthMonitor // optional health checking
+	parallel          bool
+	concurrency       int
+	nested            bool // namespace of another redundant storage
+}
+
+func (dt *redundantStorage) WithParallelKeys(concurrency int) RedundantStorage {
+	dt.parallel = true
+	dt.concurrency = concurrency
+	return dt
+}
+
+func (dt *redundantStorage) WithHealthCheck(interval time.Duration, check HealthCheck) RedundantStorage {
+	if dt.health != nil {
+		_ = dt.health.Close()
+	}
+	dt.health = newHealthMonitor(interval, check, dt.backed)
+	return dt
 }
 
-func (dt *redundant) Put(key []byte, data []byte) error {
-	return dt.writer(key, data, dt.backed)
+// Health status of each backend storage. Without health checking all storages are always healthy
+func (dt *redundantStorage) Health() []ReplicaStatus {
+	if dt.health == nil {
+		var ans = make([]ReplicaStatus, len(dt.backed))
+		for i := range ans {
+			ans[i] = ReplicaStatus{Index: i, Healthy: true}
+		}
+		return ans
+	}
+	return dt.health.snapshot()
+}
+
+func (dt *redundantStorage) Put(key []byte, data []byte) error {
+	return dt.writer(key, data, dt.active())
 }
 
-func (dt *redundant) Get(key []byte) ([]byte, error) {
-	return dt.reader(key, dt.backed)
+func (dt *redundantStorage) Get(key []byte) ([]byte, error) {
+	return dt.reader(key, dt.active())
 }
 
-func (dt *redundant) Close() error {
+func (dt *redundantStorage) Close() error {
 	var list []error
+	if dt.health != nil && !dt.nested {
+		list = append(list, dt.health.Close())
+	}
 	for _, stor := range dt.backed {
 		list = append(list, stor.Close())
 	}
 	return allErr(list...)
 }
 
-func (dt *redundant) Del(key []byte) error {
+// Remove key from all backend storages including unhealthy ones: otherwise removed key would be returned by
+// storage after recovery
+func (dt *redundantStorage) Del(key []byte) error {
 	var list []error
 	for _, stor := range dt.backed {
 		err := stor.Del(key)
@@ -63,36 +123,122 @@ func (dt *redundant) Del(key []byte) error {
 	return allErr(list...)
 }
 
-func (dt *redundant) Keys(handler func(key []byte) error) error {
+func (dt *redundantStorage) Keys(handler func(key []byte) error) error {
 	dt.iterationLock.Lock()
 	defer dt.iterationLock.Unlock()
+	unique := func(key []byte) error {
+		isExists, err := dt.keysDeduplication.SaveIfAbsent(key)
+		if err != nil {
+			return err
+		}
+		if isExists {
+			return nil
+		}
+		return handler(key)
+	}
 	var list []error
-	for _, stor := range dt.backed {
-		err := stor.Keys(func(key []byte) error {
-			isExists, err := dt.keysDeduplication.IsDuplicated(key)
+	if dt.parallel {
+		list = append(list, ParallelKeys(dt.active(), dt.concurrency, unique))
+	} else {
+		for _, stor := range dt.active() {
+			err := stor.Keys(unique)
 			if err != nil {
-				return err
+				list = append(list, err)
 			}
-			if isExists {
+		}
+	}
+	// clean prev offload if possible
+	if clearable, ok := dt.keysDeduplication.(Clearable); ok {
+		_ = clearable.Clear()
+	}
+	return allErr(list...)
+}
+
+// namespaced redundant storage if all backend storages are NamespacedStorage
+func (dt *redundantStorage) wrap() RedundantStorage {
+	for _, stor := range dt.backed {
+		if _, ok := stor.(NamespacedStorage); !ok {
+			return dt
+		}
+	}
+	return &namespacedRedundant{dt}
+}
+
+// redundant storage over namespaced backend storages
+type namespacedRedundant struct {
+	*redundantStorage
+}
+
+func (nr *namespacedRedundant) WithParallelKeys(concurrency int) RedundantStorage {
+	nr.redundantStorage.WithParallelKeys(concurrency)
+	return nr
+}
+
+func (nr *namespacedRedundant) WithHealthCheck(interval time.Duration, check HealthCheck) RedundantStorage {
+	nr.redundantStorage.WithHealthCheck(interval, check)
+	return nr
+}
+
+// Redundant storage over namespace of each backend storage with the same strategies. Namespace shares health
+// monitor of root storage: health of backend storage is checked on root level only (namespace is treated as healthy
+// if its backend storage is healthy). Health of namespace is the same as health of root storage
+func (nr *namespacedRedundant) Namespace(name []byte) (Storage, error) {
+	var nested = make([]Storage, len(nr.backed))
+	for i, stor := range nr.backed {
+		nsStorage, err := stor.(NamespacedStorage).Namespace(name)
+		if err != nil {
+			return nil, err
+		}
+		nested[i] = nsStorage
+	}
+	ns := &redundantStorage{
+		backed:            nested,
+		writer:            nr.writer,
+		reader:            nr.reader,
+		keysDeduplication: nr.keysDeduplication,
+		iterationLock:     nr.iterationLock,
+		health:            nr.health,
+		parallel:          nr.parallel,
+		concurrency:       nr.concurrency,
+		nested:            true,
+	}
+	return ns.wrap(), nil
+}
+
+func (nr *namespacedRedundant) Namespaces(handler func(name []byte) error) error {
+	var seen = make(map[string]bool)
+	for _, stor := range nr.active() {
+		err := stor.(NamespacedStorage).Namespaces(func(name []byte) error {
+			if seen[string(name)] {
 				return nil
 			}
-			err = dt.keysDeduplication.Save(key)
-			if err != nil {
-				return err
-			}
-			return handler(key)
+			seen[string(name)] = true
+			return handler(name)
 		})
 		if err != nil {
-			list = append(list, err)
+			return err
 		}
 	}
-	// clean prev offload if possible
-	if clearable, ok := dt.keysDeduplication.(Clearable); ok {
-		_ = clearable.Clear()
+	return nil
+}
+
+func (nr *namespacedRedundant) DelNamespace(name []byte) error {
+	var list []error
+	// like Del: unhealthy storages are not skipped
+	for _, stor := range nr.backed {
+		list = append(list, stor.(NamespacedStorage).DelNamespace(name))
 	}
 	return allErr(list...)
 }
 
+// storages available for operations
+func (dt *redundantStorage) active() []Storage {
+	if dt.health == nil {
+		return dt.backed
+	}
+	return dt.health.filter(dt.backed)
+}
+
 func allErr(list ...error) error {
 	var ans []string
 	for _, err := range list {
@@ -122,6 +268,8 @@ func AtLeast(minWrite int) DWriter {
 			}
 		}
 		if wrote < minWrite {
+			// storages could be excluded (unhealthy), so error is returned even if there are no failed writes
+			list = append(list, errors.Errorf("written to %v storages, required at least %v", wrote, minWrite))
 			return allErr(list...)
 		}
 		return nil
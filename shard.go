@@ -1,6 +1,7 @@
 package storages
 
 import (
+	"github.com/pkg/errors"
 	"io"
 )
 
@@ -13,13 +14,50 @@ type ShardPool interface {
 	io.Closer
 }
 
-// Sharded storage with defined pool (strategy)
-func Sharded(pool ShardPool) Storage {
-	return &shardedStorage{pool: pool}
+// Sharding pool that can select only shards relevant to keys prefix
+type PrefixShardPool interface {
+	ShardPool
+	// Iterate over shards that may contain keys with defined prefix
+	IteratePrefix(prefix []byte, handler func(storage Storage) error) error
+}
+
+// Sharding pool that can make the same distribution over namespaces of shards
+type NamespacedShardPool interface {
+	ShardPool
+	// Pool over namespace of each shard with the same distribution. Shards should be NamespacedStorage
+	Namespace(name []byte) (ShardPool, error)
+}
+
+// Sharded storage with defined pool (strategy). Storage implements PrefixedStorage: if pool is PrefixShardPool
+// only relevant shards will be scanned.
+//
+// Storage implements NamespacedStorage only if pool is NamespacedShardPool and all shards are NamespacedStorage
+// (shards are iterated once by constructor). Namespace is a sharded storage over pool of shards namespaces,
+// Namespaces and DelNamespace fan out to all shards.
+func Sharded(pool ShardPool) ShardedStorage {
+	shard := &shardedStorage{pool: pool}
+	return shard.wrap()
+}
+
+// Sharded storage over pool of shards (see Sharded)
+type ShardedStorage interface {
+	PrefixedStorage
+	// Iterate keys over shards concurrently with at most concurrency shards at a time (non-positive means
+	// all shards at once). Handler invocations are serialized, first error cancels iteration.
+	// See ParallelKeys for details. Should be called before usage.
+	WithParallelKeys(concurrency int) ShardedStorage
 }
 
 type shardedStorage struct {
-	pool ShardPool
+	pool        ShardPool
+	parallel    bool
+	concurrency int
+}
+
+func (shard *shardedStorage) WithParallelKeys(concurrency int) ShardedStorage {
+	shard.parallel = true
+	shard.concurrency = concurrency
+	return shard
 }
 
 func (shard *shardedStorage) Put(key []byte, data []byte) error {
@@ -54,7 +92,124 @@ func (shard *shardedStorage) Del(key []byte) error {
 }
 
 func (shard *shardedStorage) Keys(handler func(key []byte) error) error {
+	if shard.parallel {
+		list, err := collectShards(shard.pool.Iterate)
+		if err != nil {
+			return err
+		}
+		return ParallelKeys(list, shard.concurrency, handler)
+	}
 	return shard.pool.Iterate(func(storage Storage) error {
 		return storage.Keys(handler)
 	})
 }
+
+func (shard *shardedStorage) KeysPrefix(prefix []byte, handler func(key []byte) error) error {
+	iterate := shard.pool.Iterate
+	if pool, ok := shard.pool.(PrefixShardPool); ok {
+		iterate = func(visit func(storage Storage) error) error {
+			return pool.IteratePrefix(prefix, visit)
+		}
+	}
+	if shard.parallel {
+		list, err := collectShards(iterate)
+		if err != nil {
+			return err
+		}
+		var prefixed = make([]Storage, len(list))
+		for i, storage := range list {
+			prefixed[i] = &prefixView{storage: storage, prefix: prefix}
+		}
+		return ParallelKeys(prefixed, shard.concurrency, handler)
+	}
+	return iterate(func(storage Storage) error {
+		return KeysPrefix(storage, prefix, handler)
+	})
+}
+
+// namespaced sharded storage if pool is NamespacedShardPool and all shards are NamespacedStorage
+func (shard *shardedStorage) wrap() ShardedStorage {
+	if _, ok := shard.pool.(NamespacedShardPool); !ok {
+		return shard
+	}
+	var namespaced = true
+	err := shard.pool.Iterate(func(storage Storage) error {
+		_, ok := storage.(NamespacedStorage)
+		namespaced = namespaced && ok
+		return nil
+	})
+	if err != nil || !namespaced {
+		return shard
+	}
+	return &namespacedSharded{shard}
+}
+
+// sharded storage over namespaced pool
+type namespacedSharded struct {
+	*shardedStorage
+}
+
+func (ns *namespacedSharded) WithParallelKeys(concurrency int) ShardedStorage {
+	ns.shardedStorage.WithParallelKeys(concurrency)
+	return ns
+}
+
+func (ns *namespacedSharded) Namespace(name []byte) (Storage, error) {
+	nsPool, err := ns.pool.(NamespacedShardPool).Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	nested := &shardedStorage{pool: nsPool, parallel: ns.parallel, concurrency: ns.concurrency}
+	return nested.wrap(), nil
+}
+
+func (ns *namespacedSharded) Namespaces(handler func(name []byte) error) error {
+	var seen = make(map[string]bool)
+	return ns.pool.Iterate(func(storage Storage) error {
+		// shards could be added to pool after construction
+		nsStorage, ok := storage.(NamespacedStorage)
+		if !ok {
+			return errors.New("shard does not support namespaces")
+		}
+		return nsStorage.Namespaces(func(name []byte) error {
+			if seen[string(name)] {
+				return nil
+			}
+			seen[string(name)] = true
+			return handler(name)
+		})
+	})
+}
+
+func (ns *namespacedSharded) DelNamespace(name []byte) error {
+	return ns.pool.Iterate(func(storage Storage) error {
+		nsStorage, ok := storage.(NamespacedStorage)
+		if !ok {
+			return errors.New("shard does not support namespaces")
+		}
+		return nsStorage.DelNamespace(name)
+	})
+}
+
+func collectShards(iterate func(handler func(storage Storage) error) error) ([]Storage, error) {
+	var list []Storage
+	err := iterate(func(storage Storage) error {
+		list = append(list, storage)
+		return nil
+	})
+	return list, err
+}
+
+// storage with keys limited by prefix
+type prefixView struct {
+	storage Storage
+	prefix  []byte
+}
+
+func (pv *prefixView) Put(key []byte, data []byte) error { return pv.storage.Put(key, data) }
+func (pv *prefixView) Get(key []byte) ([]byte, error)    { return pv.storage.Get(key) }
+func (pv *prefixView) Del(key []byte) error              { return pv.storage.Del(key) }
+func (pv *prefixView) Close() error                      { return pv.storage.Close() }
+func (pv *prefixView) Keys(handler func(key []byte) error) error {
+	return KeysPrefix(pv.storage, pv.prefix, handler)
+}
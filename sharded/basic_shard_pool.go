@@ -1,6 +1,7 @@
 package sharded
 
 import (
+	"github.com/pkg/errors"
 	"github.com/reddec/storages"
 	"hash/crc32"
 	"sync"
@@ -72,6 +73,18 @@ func (hs *hashShard) Iterate(handler func(storage storages.Storage) error) error
 	return nil
 }
 
+// Pool over namespace of each shard. Namespaces are opened on-demand
+func (hs *hashShard) Namespace(name []byte) (storages.ShardPool, error) {
+	name = copyBytes(name)
+	return NewHashedCustom(uint32(len(hs.shards)), func(shardID uint32) (storages.Storage, error) {
+		storage, err := hs.getOrCreate(shardID)
+		if err != nil {
+			return nil, err
+		}
+		return namespaceOf(storage, name)
+	}, hs.hashFunc), nil
+}
+
 func (hs *hashShard) Close() error {
 	for _, shard := range hs.shards {
 		shard.lock.Lock()
@@ -86,19 +99,19 @@ func (hs *hashShard) Close() error {
 func (hs *hashShard) getOrCreate(shardID uint32) (storages.Storage, error) {
 	shard := hs.shards[shardID]
 	if shard.storage != nil {
-		return &noClose{shard.storage}, nil
+		return noCloseOf(shard.storage), nil
 	}
 	shard.lock.Lock()
 	defer shard.lock.Unlock()
 	if shard.storage != nil {
-		return &noClose{shard.storage}, nil
+		return noCloseOf(shard.storage), nil
 	}
 	storage, err := hs.factory(shardID)
 	if err != nil {
 		return nil, err
 	}
 	shard.storage = storage
-	return &noClose{shard.storage}, nil
+	return noCloseOf(shard.storage), nil
 }
 
 type noClose struct {
@@ -110,3 +123,43 @@ func (n *noClose) Put(key []byte, data []byte) error         { return n.storage.
 func (n *noClose) Get(key []byte) ([]byte, error)            { return n.storage.Get(key) }
 func (n *noClose) Del(key []byte) error                      { return n.storage.Del(key) }
 func (n *noClose) Keys(handler func(key []byte) error) error { return n.storage.Keys(handler) }
+
+// shard without closing: namespaced if storage is NamespacedStorage
+func noCloseOf(storage storages.Storage) storages.Storage {
+	if _, ok := storage.(storages.NamespacedStorage); ok {
+		return &namespacedNoClose{&noClose{storage}}
+	}
+	return &noClose{storage}
+}
+
+type namespacedNoClose struct {
+	*noClose
+}
+
+func (n *namespacedNoClose) Namespace(name []byte) (storages.Storage, error) {
+	return n.storage.(storages.NamespacedStorage).Namespace(name)
+}
+
+func (n *namespacedNoClose) Namespaces(handler func(name []byte) error) error {
+	return n.storage.(storages.NamespacedStorage).Namespaces(handler)
+}
+
+func (n *namespacedNoClose) DelNamespace(name []byte) error {
+	return n.storage.(storages.NamespacedStorage).DelNamespace(name)
+}
+
+var errNoNamespaces = errors.New("shard does not support namespaces")
+
+func namespaceOf(storage storages.Storage, name []byte) (storages.Storage, error) {
+	ns, ok := unwrap(storage).(storages.NamespacedStorage)
+	if !ok {
+		return nil, errNoNamespaces
+	}
+	return ns.Namespace(name)
+}
+
+func copyBytes(data []byte) []byte {
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	return cp
+}
@@ -0,0 +1,186 @@
+package sharded
+
+import (
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default number of virtual nodes per shard for consistent hashing
+const DefaultVirtualNodes = 128
+
+// New consistent hashing shard pool based on default hash distribution IEEE CRC-32. See NewConsistentCustom for details.
+func NewConsistent(virtualNodes int) *consistentShard {
+	return NewConsistentCustom(virtualNodes, crc32.ChecksumIEEE)
+}
+
+// New consistent hashing shard pool based on custom hash function. Each shard placed to the hash ring as
+// virtualNodes * weight points, so adding or removing shard remaps only keys of the nearest points.
+// Shards are identified by unique names - ring position depends only on name, not on order of adding.
+// If virtualNodes is not positive then DefaultVirtualNodes used.
+// Shards could be added and removed in runtime. Thread safe.
+func NewConsistentCustom(virtualNodes int, hashFunc HashShardFunc) *consistentShard {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &consistentShard{
+		virtualNodes: virtualNodes,
+		hashFunc:     hashFunc,
+		shards:       make(map[string]*ringShard),
+	}
+}
+
+type ringShard struct {
+	name    string
+	weight  int
+	storage storages.Storage
+}
+
+type ringPoint struct {
+	hash  uint32
+	shard *ringShard
+}
+
+type consistentShard struct {
+	virtualNodes int
+	hashFunc     HashShardFunc
+	lock         sync.RWMutex
+	shards       map[string]*ringShard
+	ring         []ringPoint // sorted by hash
+}
+
+// Add storage as shard with unique name and weight (relative capacity, non-positive treated as 1).
+// Storage will be closed together with pool
+func (cs *consistentShard) Add(name string, storage storages.Storage, weight int) error {
+	if weight <= 0 {
+		weight = 1
+	}
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if _, exists := cs.shards[name]; exists {
+		return errors.Errorf("shard %v already added", name)
+	}
+	cs.shards[name] = &ringShard{
+		name:    name,
+		weight:  weight,
+		storage: storage,
+	}
+	cs.rebuild()
+	return nil
+}
+
+// Remove shard by name and return storage. Removed storage will not be closed. Keys of removed shard
+// will not be migrated automatically
+func (cs *consistentShard) Remove(name string) (storages.Storage, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	shard, exists := cs.shards[name]
+	if !exists {
+		return nil, errors.Errorf("shard %v not found", name)
+	}
+	delete(cs.shards, name)
+	cs.rebuild()
+	return shard.storage, nil
+}
+
+// Names of all shards in lexicographical order
+func (cs *consistentShard) Names() []string {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return cs.names()
+}
+
+func (cs *consistentShard) Get(key []byte) (storages.Storage, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	if len(cs.ring) == 0 {
+		return nil, errors.New("no shards in pool")
+	}
+	hash := cs.hashFunc(key)
+	idx := sort.Search(len(cs.ring), func(i int) bool {
+		return cs.ring[i].hash >= hash
+	})
+	if idx == len(cs.ring) {
+		idx = 0
+	}
+	return noCloseOf(cs.ring[idx].shard.storage), nil
+}
+
+func (cs *consistentShard) Iterate(handler func(storage storages.Storage) error) error {
+	cs.lock.RLock()
+	var list = make([]storages.Storage, 0, len(cs.shards))
+	for _, name := range cs.names() {
+		list = append(list, noCloseOf(cs.shards[name].storage))
+	}
+	cs.lock.RUnlock()
+	for _, storage := range list {
+		err := handler(storage)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pool over namespace of each shard with the same names and weights. Shards added or removed later
+// in parent pool are not reflected in the namespace pool
+func (cs *consistentShard) Namespace(name []byte) (storages.ShardPool, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	pool := NewConsistentCustom(cs.virtualNodes, cs.hashFunc)
+	for shardName, shard := range cs.shards {
+		ns, err := namespaceOf(shard.storage, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "namespace of shard %v", shardName)
+		}
+		pool.shards[shardName] = &ringShard{
+			name:    shardName,
+			weight:  shard.weight,
+			storage: ns,
+		}
+	}
+	pool.rebuild()
+	return pool, nil
+}
+
+func (cs *consistentShard) Close() error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	for _, shard := range cs.shards {
+		shard.storage.Close()
+	}
+	return nil
+}
+
+func (cs *consistentShard) names() []string {
+	var names = make([]string, 0, len(cs.shards))
+	for name := range cs.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cs *consistentShard) rebuild() {
+	var ring []ringPoint
+	for _, shard := range cs.shards {
+		points := cs.virtualNodes * shard.weight
+		for i := 0; i < points; i++ {
+			ring = append(ring, ringPoint{
+				hash:  cs.hashFunc([]byte(shard.name + "#" + strconv.Itoa(i))),
+				shard: shard,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash == ring[j].hash {
+			// deterministic order on collisions
+			return ring[i].shard.name < ring[j].shard.name
+		}
+		return ring[i].hash < ring[j].hash
+	})
+	cs.ring = ring
+}
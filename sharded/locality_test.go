@@ -0,0 +1,106 @@
+package sharded
+
+import (
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"testing"
+)
+
+func TestNewRanged(t *testing.T) {
+	shards := []storages.Storage{memstorage.New(), memstorage.New(), memstorage.New()}
+	pool := NewRanged([][]byte{[]byte("g"), []byte("p")}, shards)
+	stor := storages.Sharded(pool)
+	defer stor.Close()
+
+	for _, key := range []string{"alice", "bob", "george", "harry", "paul", "zed"} {
+		if err := stor.Put([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := [][]string{{"alice", "bob"}, {"george", "harry"}, {"paul", "zed"}}
+	for i, keys := range expected {
+		for _, key := range keys {
+			if _, err := shards[i].Get([]byte(key)); err != nil {
+				t.Error(key, "not in shard", i)
+			}
+		}
+	}
+	visited := countShards(t, pool, []byte("h"))
+	if visited != 1 {
+		t.Error("expected 1 visited shard but got", visited)
+	}
+	visited = countShards(t, pool, nil)
+	if visited != 3 {
+		t.Error("expected 3 visited shards but got", visited)
+	}
+	keys := prefixKeys(t, stor, "ge")
+	if len(keys) != 1 || keys[0] != "george" {
+		t.Error("unexpected keys by prefix:", keys)
+	}
+}
+
+func TestNewPrefix(t *testing.T) {
+	tenant1 := memstorage.New()
+	tenant2 := memstorage.New()
+	vip := memstorage.New()
+	fallback := memstorage.New()
+	pool := NewPrefix(map[string]storages.Storage{
+		"t1/":     tenant1,
+		"t1/vip/": vip,
+		"t2/":     tenant2,
+	}, fallback)
+	stor := storages.Sharded(pool)
+	defer stor.Close()
+
+	routes := map[string]storages.Storage{
+		"t1/alice":   tenant1,
+		"t1/vip/bob": vip,
+		"t2/carl":    tenant2,
+		"t3/dave":    fallback,
+	}
+	for key, shard := range routes {
+		if err := stor.Put([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := shard.Get([]byte(key)); err != nil {
+			t.Error(key, "routed to wrong shard")
+		}
+	}
+	if visited := countShards(t, pool, []byte("t1/")); visited != 2 {
+		t.Error("expected 2 visited shards but got", visited)
+	}
+	if visited := countShards(t, pool, []byte("t2/x")); visited != 1 {
+		t.Error("expected 1 visited shard but got", visited)
+	}
+	if visited := countShards(t, pool, []byte("t3/")); visited != 1 {
+		t.Error("expected 1 visited shard but got", visited)
+	}
+	keys := prefixKeys(t, stor, "t1/")
+	if len(keys) != 2 {
+		t.Error("unexpected keys by prefix:", keys)
+	}
+}
+
+func countShards(t *testing.T, pool storages.PrefixShardPool, prefix []byte) int {
+	var visited int
+	err := pool.IteratePrefix(prefix, func(storage storages.Storage) error {
+		visited++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return visited
+}
+
+func prefixKeys(t *testing.T, stor storages.Storage, prefix string) []string {
+	var keys []string
+	err := storages.KeysPrefix(stor, []byte(prefix), func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
@@ -0,0 +1,146 @@
+package sharded
+
+import (
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"sort"
+	"strings"
+)
+
+// New shard pool that routes keys by the longest matching prefix from lookup table (like tenant ID: "tenant1/").
+// Keys without matched prefix are routed to fallback storage. If fallback is nil, Get returns error for such keys.
+// Same storage could be used for several prefixes.
+func NewPrefix(table map[string]storages.Storage, fallback storages.Storage) *prefixShard {
+	var prefixes = make([]string, 0, len(table))
+	for prefix := range table {
+		prefixes = append(prefixes, prefix)
+	}
+	// longest first to find the longest match by first match
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) == len(prefixes[j]) {
+			return prefixes[i] < prefixes[j]
+		}
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	return &prefixShard{
+		prefixes: prefixes,
+		table:    table,
+		fallback: fallback,
+	}
+}
+
+type prefixShard struct {
+	prefixes []string
+	table    map[string]storages.Storage
+	fallback storages.Storage
+}
+
+func (ps *prefixShard) Get(key []byte) (storages.Storage, error) {
+	storage := ps.lookup(string(key))
+	if storage == nil {
+		return nil, errors.Errorf("no shard for key %v", string(key))
+	}
+	return noCloseOf(storage), nil
+}
+
+func (ps *prefixShard) Iterate(handler func(storage storages.Storage) error) error {
+	return ps.visit(ps.unique(func(prefix string) bool { return true }, true), handler)
+}
+
+func (ps *prefixShard) IteratePrefix(prefix []byte, handler func(storage storages.Storage) error) error {
+	query := string(prefix)
+	// keys with the query prefix routed to the longest table prefix that is prefix of query
+	// or to longer table prefixes that start with query
+	var longestMatched string
+	var hasMatched bool
+	for _, p := range ps.prefixes {
+		if strings.HasPrefix(query, p) {
+			longestMatched = p
+			hasMatched = true
+			break
+		}
+	}
+	list := ps.unique(func(p string) bool {
+		return strings.HasPrefix(p, query) || (hasMatched && p == longestMatched)
+	}, !hasMatched)
+	return ps.visit(list, handler)
+}
+
+// Pool over namespace of each shard with the same lookup table
+func (ps *prefixShard) Namespace(name []byte) (storages.ShardPool, error) {
+	var opened = make(map[storages.Storage]storages.Storage)
+	open := func(storage storages.Storage) (storages.Storage, error) {
+		if ns, ok := opened[storage]; ok {
+			return ns, nil
+		}
+		ns, err := namespaceOf(storage, name)
+		if err != nil {
+			return nil, err
+		}
+		opened[storage] = ns
+		return ns, nil
+	}
+	var table = make(map[string]storages.Storage, len(ps.table))
+	for prefix, storage := range ps.table {
+		ns, err := open(storage)
+		if err != nil {
+			return nil, errors.Wrapf(err, "namespace of shard for prefix %v", prefix)
+		}
+		table[prefix] = ns
+	}
+	var fallback storages.Storage
+	if ps.fallback != nil {
+		ns, err := open(ps.fallback)
+		if err != nil {
+			return nil, errors.Wrap(err, "namespace of fallback shard")
+		}
+		fallback = ns
+	}
+	return NewPrefix(table, fallback), nil
+}
+
+func (ps *prefixShard) Close() error {
+	for _, storage := range ps.unique(func(prefix string) bool { return true }, true) {
+		storage.Close()
+	}
+	return nil
+}
+
+func (ps *prefixShard) lookup(key string) storages.Storage {
+	for _, prefix := range ps.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return ps.table[prefix]
+		}
+	}
+	return ps.fallback
+}
+
+// unique storages for prefixes accepted by filter in order of prefixes with optional fallback at the end
+func (ps *prefixShard) unique(filter func(prefix string) bool, withFallback bool) []storages.Storage {
+	var ans []storages.Storage
+	var seen = make(map[storages.Storage]bool)
+	for _, prefix := range ps.prefixes {
+		if !filter(prefix) {
+			continue
+		}
+		storage := ps.table[prefix]
+		if !seen[storage] {
+			seen[storage] = true
+			ans = append(ans, storage)
+		}
+	}
+	if withFallback && ps.fallback != nil && !seen[ps.fallback] {
+		ans = append(ans, ps.fallback)
+	}
+	return ans
+}
+
+func (ps *prefixShard) visit(list []storages.Storage, handler func(storage storages.Storage) error) error {
+	for _, storage := range list {
+		err := handler(noCloseOf(storage))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
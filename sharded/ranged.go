@@ -0,0 +1,102 @@
+package sharded
+
+import (
+	"bytes"
+	"github.com/reddec/storages"
+	"sort"
+)
+
+// New shard pool based on sorted key ranges. Split points define bounds of shards: shard 0 contains keys
+// less than splits[0], shard i contains keys in range [splits[i-1], splits[i]) and the last shard contains keys
+// greater or equal to the last split point. Number of shards should be number of split points plus one.
+// Split points should be strictly increasing. Keys locality is kept, so prefix iteration touches only relevant shards.
+func NewRanged(splits [][]byte, shards []storages.Storage) *rangedShard {
+	if len(shards) != len(splits)+1 {
+		panic("number of shards should be number of split points plus one")
+	}
+	for i := 1; i < len(splits); i++ {
+		if bytes.Compare(splits[i-1], splits[i]) >= 0 {
+			panic("split points are not strictly increasing")
+		}
+	}
+	return &rangedShard{
+		splits: splits,
+		shards: shards,
+	}
+}
+
+type rangedShard struct {
+	splits [][]byte
+	shards []storages.Storage
+}
+
+func (rs *rangedShard) Get(key []byte) (storages.Storage, error) {
+	return noCloseOf(rs.shards[rs.index(key)]), nil
+}
+
+func (rs *rangedShard) Iterate(handler func(storage storages.Storage) error) error {
+	for _, shard := range rs.shards {
+		err := handler(noCloseOf(shard))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *rangedShard) IteratePrefix(prefix []byte, handler func(storage storages.Storage) error) error {
+	first := rs.index(prefix)
+	last := len(rs.shards) - 1
+	if end := prefixEnd(prefix); end != nil {
+		// shard that contains the greatest key with prefix (exclusive bound)
+		last = sort.Search(len(rs.splits), func(i int) bool {
+			return bytes.Compare(rs.splits[i], end) >= 0
+		})
+	}
+	for i := first; i <= last; i++ {
+		err := handler(noCloseOf(rs.shards[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pool over namespace of each shard with the same split points
+func (rs *rangedShard) Namespace(name []byte) (storages.ShardPool, error) {
+	var shards = make([]storages.Storage, len(rs.shards))
+	for i, shard := range rs.shards {
+		ns, err := namespaceOf(shard, name)
+		if err != nil {
+			return nil, err
+		}
+		shards[i] = ns
+	}
+	return NewRanged(rs.splits, shards), nil
+}
+
+func (rs *rangedShard) Close() error {
+	for _, shard := range rs.shards {
+		shard.Close()
+	}
+	return nil
+}
+
+func (rs *rangedShard) index(key []byte) int {
+	return sort.Search(len(rs.splits), func(i int) bool {
+		return bytes.Compare(rs.splits[i], key) > 0
+	})
+}
+
+// smallest key that is greater than all keys with prefix or nil if there is no such key
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package sharded
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"github.com/reddec/storages"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+const (
+	checkpointPrefix   = "reshard:"
+	checkpointShardKey = "shard" // index of shard in old pool that currently migrating
+	checkpointMovedKey = "moved" // total number of moved keys
+	defaultBatchSize   = 1024
+	keyLocks           = 64
+)
+
+var errBatchFull = errors.New("batch is full")
+
+// Progress handler of migration: index of shard (in order of Iterate) in old pool and total number of moved keys
+type ProgressFunc func(shard int, moved int64)
+
+// New rebalancer that moves keys from old pool to new pool. Keys are moved only if shard for key in new pool is
+// not the same storage as in old pool. Storages shared between pools should be the same instances (shards are
+// compared by reference), otherwise keys will be copied to itself and then removed.
+// Progress is checkpointed to the checkpoint storage so migration could be resumed after restart, checkpoint
+// is removed after successful migration. Old pool should return shards in the same order during Iterate.
+//
+// During migration use Storage() as a storage for application: reads are dual (new, then old) and writes
+// are going to new pool.
+func NewRebalancer(oldPool, newPool storages.ShardPool, checkpoint storages.Storage) *rebalancer {
+	return &rebalancer{
+		oldPool:    oldPool,
+		newPool:    newPool,
+		checkpoint: checkpoint,
+		batchSize:  defaultBatchSize,
+	}
+}
+
+type rebalancer struct {
+	oldPool      storages.ShardPool
+	newPool      storages.ShardPool
+	checkpoint   storages.Storage
+	checkpointID string
+	batchSize    int
+	progress     ProgressFunc
+	locks        [keyLocks]sync.Mutex
+}
+
+// Maximum number of keys collected from shard before moving (default 1024). Should be called before Run
+func (rb *rebalancer) WithBatchSize(size int) *rebalancer {
+	if size > 0 {
+		rb.batchSize = size
+	}
+	return rb
+}
+
+// Identity of migration (for example hash of pools configurations) that used in checkpoint keys, so
+// checkpoint of another migration in the same storage is not resumed. Should be called before Run
+func (rb *rebalancer) WithCheckpointID(id string) *rebalancer {
+	rb.checkpointID = id
+	return rb
+}
+
+// Handler that will be called after each moved batch. Should be called before Run
+func (rb *rebalancer) WithProgress(handler ProgressFunc) *rebalancer {
+	rb.progress = handler
+	return rb
+}
+
+// Run (or resume) migration till all keys moved, first error or context canceled
+func (rb *rebalancer) Run(ctx context.Context) error {
+	startShard, err := loadCounter(rb.checkpoint, rb.checkpointKey(checkpointShardKey))
+	if err != nil {
+		return errors.Wrap(err, "load checkpoint of shard")
+	}
+	moved, err := loadCounter(rb.checkpoint, rb.checkpointKey(checkpointMovedKey))
+	if err != nil {
+		return errors.Wrap(err, "load checkpoint of moved keys")
+	}
+	var shardIndex uint64
+	err = rb.oldPool.Iterate(func(shard storages.Storage) error {
+		defer func() { shardIndex++ }()
+		if shardIndex < startShard {
+			return nil
+		}
+		err := rb.batches(shard, func(batch [][]byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, key := range batch {
+				err := rb.move(key, shard)
+				if err != nil {
+					return errors.Wrapf(err, "move key %v from shard %v", string(key), shardIndex)
+				}
+				moved++
+			}
+			err := saveCounter(rb.checkpoint, rb.checkpointKey(checkpointMovedKey), moved)
+			if err != nil {
+				return errors.Wrap(err, "save checkpoint of moved keys")
+			}
+			if rb.progress != nil {
+				rb.progress(int(shardIndex), int64(moved))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = saveCounter(rb.checkpoint, rb.checkpointKey(checkpointShardKey), shardIndex+1)
+		if err != nil {
+			return errors.Wrap(err, "save checkpoint of shard")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(rb.Reset(), "remove checkpoint")
+}
+
+// Reset checkpoint to start migration from the beginning
+func (rb *rebalancer) Reset() error {
+	for _, key := range []string{checkpointShardKey, checkpointMovedKey} {
+		err := rb.checkpoint.Del([]byte(rb.checkpointKey(key)))
+		if err != nil && err != os.ErrNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+// Storage view over both pools during migration. Get returns value from new pool, then from old one.
+// Put writes to new pool and removes key from old pool. Del removes from both pools. Keys iterates over new pool
+// and then over keys from old pool that are not yet in new one. Close is no-op: pools should be closed separately.
+func (rb *rebalancer) Storage() storages.Storage {
+	return &migratingStorage{rb: rb}
+}
+
+func (rb *rebalancer) checkpointKey(name string) string {
+	if rb.checkpointID == "" {
+		return checkpointPrefix + name
+	}
+	return checkpointPrefix + rb.checkpointID + ":" + name
+}
+
+// pass keys that should be moved from shard (stored in old pool) by batches. Ordered shards are scanned by
+// ranges after the last scanned key. Other shards can not be changed during iteration, so each pass collects
+// one batch of keys that are still in shard (moved keys are removed from shard by handler)
+func (rb *rebalancer) batches(shard storages.Storage, handler func(batch [][]byte) error) error {
+	ordered, ok := unwrap(shard).(storages.OrderedStorage)
+	if !ok {
+		var previous [][]byte
+		for {
+			batch, _, err := rb.collect(shard, shard.Keys, rb.batchSize)
+			if err != nil || len(batch) == 0 {
+				return err
+			}
+			if sameKeys(batch, previous) {
+				return errors.New("moved keys are still in shard")
+			}
+			err = handler(batch)
+			if err != nil {
+				return err
+			}
+			previous = batch
+		}
+	}
+	var from []byte
+	for {
+		batch, last, err := rb.collect(shard, func(visit func(key []byte) error) error {
+			return ordered.KeysRange(from, nil, visit)
+		}, rb.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			err = handler(batch)
+			if err != nil {
+				return err
+			}
+		}
+		if last == nil {
+			return nil
+		}
+		// the smallest key after the last scanned
+		from = append(last, 0)
+	}
+}
+
+// collect keys that should be moved till limit (0 means no limit) reached. Returns copy of the last scanned key
+// if iteration stopped by limit
+func (rb *rebalancer) collect(shard storages.Storage, iterate func(visit func(key []byte) error) error, limit int) ([][]byte, []byte, error) {
+	var batch [][]byte
+	var last []byte
+	err := iterate(func(key []byte) error {
+		target, err := rb.newPool.Get(key)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		if sameStorage(target, shard) {
+			return nil
+		}
+		cp := make([]byte, len(key))
+		copy(cp, key)
+		batch = append(batch, cp)
+		if limit > 0 && len(batch) >= limit {
+			last = cp
+			return errBatchFull
+		}
+		return nil
+	})
+	if err == errBatchFull {
+		err = nil
+	}
+	return batch, last, err
+}
+
+func sameKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rb *rebalancer) move(key []byte, from storages.Storage) error {
+	lock := rb.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := from.Get(key)
+	if err == os.ErrNotExist {
+		// removed or moved concurrently
+		return nil
+	} else if err != nil {
+		return err
+	}
+	target, err := rb.newPool.Get(key)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	err = target.Put(key, data)
+	if err != nil {
+		return err
+	}
+	return from.Del(key)
+}
+
+func (rb *rebalancer) lockFor(key []byte) *sync.Mutex {
+	return &rb.locks[crc32.ChecksumIEEE(key)%keyLocks]
+}
+
+type migratingStorage struct {
+	rb *rebalancer
+}
+
+func (ms *migratingStorage) Get(key []byte) ([]byte, error) {
+	data, err := ms.get(ms.rb.newPool, key)
+	if err != os.ErrNotExist {
+		return data, err
+	}
+	return ms.get(ms.rb.oldPool, key)
+}
+
+func (ms *migratingStorage) Put(key []byte, data []byte) error {
+	lock := ms.rb.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+	target, err := ms.rb.newPool.Get(key)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	err = target.Put(key, data)
+	if err != nil {
+		return err
+	}
+	source, err := ms.rb.oldPool.Get(key)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	if sameStorage(source, target) {
+		return nil
+	}
+	return source.Del(key)
+}
+
+func (ms *migratingStorage) Del(key []byte) error {
+	lock := ms.rb.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+	target, err := ms.rb.newPool.Get(key)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	err = target.Del(key)
+	if err != nil {
+		return err
+	}
+	source, err := ms.rb.oldPool.Get(key)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return source.Del(key)
+}
+
+func (ms *migratingStorage) Keys(handler func(key []byte) error) error {
+	err := ms.rb.newPool.Iterate(func(storage storages.Storage) error {
+		return storage.Keys(handler)
+	})
+	if err != nil {
+		return err
+	}
+	return ms.rb.oldPool.Iterate(func(storage storages.Storage) error {
+		return storage.Keys(func(key []byte) error {
+			_, err := ms.get(ms.rb.newPool, key)
+			if err == nil {
+				// already moved
+				return nil
+			} else if err != os.ErrNotExist {
+				return err
+			}
+			return handler(key)
+		})
+	})
+}
+
+func (ms *migratingStorage) Close() error { return nil }
+
+func (ms *migratingStorage) get(pool storages.ShardPool, key []byte) ([]byte, error) {
+	storage, err := pool.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+	return storage.Get(key)
+}
+
+// compare storages without no-close wrappers
+func sameStorage(a, b storages.Storage) bool {
+	return unwrap(a) == unwrap(b)
+}
+
+func unwrap(storage storages.Storage) storages.Storage {
+	switch nc := storage.(type) {
+	case *noClose:
+		return nc.storage
+	case *namespacedNoClose:
+		return nc.storage
+	}
+	return storage
+}
+
+// Close pools that could share storages (like pools parsed by config.ParsePoolsJSON): each storage is closed once.
+// Pools themselves are not closed
+func ClosePools(pools ...storages.ShardPool) error {
+	var closed = make(map[storages.Storage]bool)
+	var list []storages.Storage
+	for _, pool := range pools {
+		err := pool.Iterate(func(storage storages.Storage) error {
+			storage = unwrap(storage)
+			if !closed[storage] {
+				closed[storage] = true
+				list = append(list, storage)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	var errs []string
+	for _, storage := range list {
+		if err := storage.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("close storages: %v", errs)
+	}
+	return nil
+}
+
+func loadCounter(storage storages.Storage, key string) (uint64, error) {
+	data, err := storage.Get([]byte(key))
+	if err == os.ErrNotExist {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, errors.Errorf("broken data: required 8 bytes")
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func saveCounter(storage storages.Storage, key string, value uint64) error {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], value)
+	return storage.Put([]byte(key), data[:])
+}
@@ -0,0 +1,135 @@
+package sharded
+
+import (
+	"context"
+	"fmt"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"testing"
+)
+
+func TestRebalancer_Run(t *testing.T) {
+	testRebalancer(t, func() storages.Storage { return memstorage.New() })
+}
+
+func TestRebalancer_RunOrdered(t *testing.T) {
+	testRebalancer(t, func() storages.Storage { return &orderedStorage{memstorage.New()} })
+}
+
+// storage with range iteration to check migration by ranges
+type orderedStorage struct {
+	storages.Storage
+}
+
+func (ord *orderedStorage) KeysRange(from, to []byte, handler func(key []byte) error) error {
+	return storages.KeysRange(ord.Storage, from, to, handler)
+}
+
+func testRebalancer(t *testing.T, factory func() storages.Storage) {
+	shards := []storages.Storage{factory(), factory(), factory()}
+	oldPool := NewHashedArray(shards[:2])
+	newPool := NewHashedArray(shards)
+
+	old := storages.Sharded(oldPool)
+	const keys = 100
+	for i := 0; i < keys; i++ {
+		if err := old.Put([]byte(fmt.Sprint("key-", i)), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoint := memstorage.New()
+	var moved int64
+	rebalancer := NewRebalancer(oldPool, newPool, checkpoint).WithCheckpointID("test").WithBatchSize(7).WithProgress(func(shard int, total int64) {
+		moved = total
+	})
+	view := rebalancer.Storage()
+	// update during migration goes to new pool
+	if err := view.Put([]byte("key-0"), []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rebalancer.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// each key should be in expected shard
+	result := storages.Sharded(newPool)
+	for i := 0; i < keys; i++ {
+		key := []byte(fmt.Sprint("key-", i))
+		value, err := result.Get(key)
+		if err != nil {
+			t.Fatal("get", string(key), err)
+		}
+		expected := fmt.Sprint(i)
+		if i == 0 {
+			expected = "updated"
+		}
+		if string(value) != expected {
+			t.Fatal("wrong value for", string(key), string(value))
+		}
+	}
+	total, err := storages.AllKeys(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(total) != keys {
+		t.Fatal("expected", keys, "keys but got", len(total))
+	}
+	if moved == 0 {
+		t.Fatal("nothing moved")
+	}
+	// checkpoint of completed migration is removed
+	if left, _ := storages.AllKeys(checkpoint); len(left) != 0 {
+		t.Fatal("checkpoint is not removed:", len(left))
+	}
+	// repeated migration should not move anything
+	moved = 0
+	if err := rebalancer.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if moved != 0 {
+		t.Fatal("completed migration moved keys again")
+	}
+}
+
+func TestRebalancer_checkpointKey(t *testing.T) {
+	a := NewRebalancer(nil, nil, nil).WithCheckpointID("a")
+	b := NewRebalancer(nil, nil, nil).WithCheckpointID("b")
+	if a.checkpointKey(checkpointShardKey) == b.checkpointKey(checkpointShardKey) {
+		t.Fatal("checkpoints of different migrations should not be shared")
+	}
+}
+
+func TestRebalancer_batches(t *testing.T) {
+	from, to := memstorage.New(), memstorage.New()
+	for i := 0; i < 20; i++ {
+		if err := from.Put([]byte(fmt.Sprint("key-", i)), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rebalancer := NewRebalancer(NewHashedArray([]storages.Storage{from}), NewHashedArray([]storages.Storage{to}), memstorage.New()).WithBatchSize(7)
+	var sizes []int
+	err := rebalancer.batches(from, func(batch [][]byte) error {
+		sizes = append(sizes, len(batch))
+		for _, key := range batch {
+			if err := rebalancer.move(key, from); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sizes) != "[7 7 6]" {
+		t.Fatal("keys should be passed by bounded batches, got", sizes)
+	}
+	// keys that are not removed by handler should not be passed forever
+	err = rebalancer.batches(to, func(batch [][]byte) error { return nil })
+	if err != nil {
+		t.Fatal("keys of target shard should be skipped:", err)
+	}
+	stuck := NewRebalancer(NewHashedArray([]storages.Storage{to}), NewHashedArray([]storages.Storage{from}), memstorage.New())
+	err = stuck.batches(to, func(batch [][]byte) error { return nil })
+	if err == nil {
+		t.Fatal("not moved keys should cause error")
+	}
+}
@@ -2,7 +2,10 @@ package sharded
 
 import (
 	"errors"
+	"fmt"
 	"github.com/reddec/storages"
+	"github.com/reddec/storages/std/memstorage"
+	"testing"
 )
 
 func ExampleNewHashed() {
@@ -14,3 +17,63 @@ func ExampleNewHashed() {
 	defer shardedStorage.Close()
 	// do something
 }
+
+func ExampleNewConsistent() {
+	pool := NewConsistent(DefaultVirtualNodes)
+	_ = pool.Add("shard-1", memstorage.New(), 1)
+	_ = pool.Add("shard-2", memstorage.New(), 2) // twice more keys than shard-1
+
+	shardedStorage := storages.Sharded(pool)
+	defer shardedStorage.Close()
+	// do something
+}
+
+func TestConsistentShard_Add(t *testing.T) {
+	pool := NewConsistent(DefaultVirtualNodes)
+	for i := 0; i < 4; i++ {
+		if err := pool.Add(fmt.Sprint("shard-", i), memstorage.New(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const keys = 10000
+	before := make([]storages.Storage, keys)
+	for i := range before {
+		shard, err := pool.Get([]byte(fmt.Sprint("key-", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[i] = unwrap(shard)
+	}
+	if err := pool.Add("shard-4", memstorage.New(), 1); err != nil {
+		t.Fatal(err)
+	}
+	var moved int
+	for i := range before {
+		shard, err := pool.Get([]byte(fmt.Sprint("key-", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unwrap(shard) != before[i] {
+			moved++
+		}
+	}
+	// ideally 1/5 of keys should be moved
+	if moved > keys/3 {
+		t.Error("too much keys moved:", moved)
+	}
+	if moved == 0 {
+		t.Error("no keys moved to new shard")
+	}
+	if err := pool.Add("shard-4", memstorage.New(), 1); err == nil {
+		t.Error("duplicated shard added")
+	}
+	if _, err := pool.Remove("shard-4"); err != nil {
+		t.Error(err)
+	}
+	for i := range before {
+		shard, _ := pool.Get([]byte(fmt.Sprint("key-", i)))
+		if unwrap(shard) != before[i] {
+			t.Fatal("key not returned to original shard after removing")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package boltdb
 
 import (
+	"bytes"
 	"github.com/reddec/storages"
 	"github.com/reddec/storages/std"
 	"go.etcd.io/bbolt"
@@ -50,6 +51,24 @@ func (bdb *boltDB) Put(key []byte, data []byte) error {
 	})
 }
 
+// Put value if key does not exist in a single update transaction
+func (bdb *boltDB) PutIfAbsent(key []byte, data []byte) (bool, error) {
+	var stored bool
+	err := bdb.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bdb.bucket)
+		if err != nil {
+			return err
+		}
+		// value could be empty, so check existence of key by cursor
+		if found, _ := bucket.Cursor().Seek(key); bytes.Equal(found, key) {
+			return nil
+		}
+		stored = true
+		return bucket.Put(key, data)
+	})
+	return stored, err
+}
+
 func (bdb *boltDB) Close() error {
 	if bdb.nested {
 		return nil
@@ -97,6 +116,48 @@ func (bdb *boltDB) Keys(handler func(key []byte) error) error {
 	})
 }
 
+// Iterate over keys in range [from, to) in ascending order by cursor
+func (bdb *boltDB) KeysRange(from, to []byte, handler func(key []byte) error) error {
+	return bdb.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bdb.bucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		var k []byte
+		if from == nil {
+			k, _ = cursor.First()
+		} else {
+			k, _ = cursor.Seek(from)
+		}
+		for ; k != nil && (to == nil || bytes.Compare(k, to) < 0); k, _ = cursor.Next() {
+			err := handler(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Iterate over keys that starts with prefix by cursor
+func (bdb *boltDB) KeysPrefix(prefix []byte, handler func(key []byte) error) error {
+	return bdb.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bdb.bucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			err := handler(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (bdb *boltDB) Namespace(name []byte) (storages.Storage, error) {
 	err := bdb.db.Update(func(tx *bbolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(name)
@@ -112,6 +173,23 @@ func (bdb *boltDB) Namespace(name []byte) (storages.Storage, error) {
 	}, nil
 }
 
+func (bdb *boltDB) ExistingNamespace(name []byte) (storages.Storage, error) {
+	err := bdb.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(name) == nil {
+			return os.ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltDB{
+		db:     bdb.db,
+		bucket: name,
+		nested: true,
+	}, nil
+}
+
 func (bdb *boltDB) Namespaces(handler func(name []byte) error) error {
 	return bdb.db.View(func(tx *bbolt.Tx) error {
 		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
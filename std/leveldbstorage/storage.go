@@ -5,6 +5,7 @@ import (
 	"github.com/reddec/storages/std"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -47,6 +48,29 @@ func (bdp *leveldbMap) Keys(handler func(key []byte) error) error {
 	}
 	return nil
 }
+
+// Iterate over keys in range [from, to) in ascending order
+func (bdp *leveldbMap) KeysRange(from, to []byte, handler func(key []byte) error) error {
+	return bdp.iterate(&util.Range{Start: from, Limit: to}, handler)
+}
+
+// Iterate over keys that starts with prefix
+func (bdp *leveldbMap) KeysPrefix(prefix []byte, handler func(key []byte) error) error {
+	return bdp.iterate(util.BytesPrefix(prefix), handler)
+}
+
+func (bdp *leveldbMap) iterate(slice *util.Range, handler func(key []byte) error) error {
+	it := bdp.db.NewIterator(slice, nil)
+	defer it.Release()
+	for it.Next() {
+		err := handler(it.Key())
+		if err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
 func (bdp *leveldbMap) Close() error { return bdp.db.Close() }
 
 // New storage, base on go-leveldb store
@@ -73,6 +97,11 @@ func (dbt *dbBatch) Put(key []byte, data []byte) error {
 	return nil
 }
 
+func (dbt *dbBatch) Del(key []byte) error {
+	dbt.batch.Delete(key)
+	return nil
+}
+
 func (dbt *dbBatch) Close() error {
 	return dbt.db.Write(dbt.batch, &opt.WriteOptions{})
 }
@@ -16,6 +16,10 @@ func (np *nopStorage) Keys(handler func(key []byte) error) error { return nil }
 func (np *nopStorage) Close() error                              { return nil }
 func (np *nopStorage) BatchWriter() storages.Writer              { return NewNOP() }
 
+func (np *nopStorage) Namespace(name []byte) (storages.Storage, error)  { return NewNOP(), nil }
+func (np *nopStorage) Namespaces(handler func(name []byte) error) error { return nil }
+func (np *nopStorage) DelNamespace(name []byte) error                   { return nil }
+
 // New No-Operation storage that drops any content and returns not-exists on any request.
 // Useful for mocking, performance testing or for dropping several keys.
 func NewNOP() storages.BatchedStorage {
@@ -19,6 +19,14 @@ func (bdp *memoryMap) Namespace(name []byte) (storages.Storage, error) {
 	return val.(*memoryMap), nil
 }
 
+func (bdp *memoryMap) ExistingNamespace(name []byte) (storages.Storage, error) {
+	val, ok := bdp.namespaces.Load(string(name))
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return val.(*memoryMap), nil
+}
+
 func (bdp *memoryMap) Namespaces(handler func(name []byte) error) error {
 	var err error
 	bdp.namespaces.Range(func(key, value interface{}) bool {
@@ -49,6 +57,22 @@ func (bdp *memoryMap) Put(key []byte, value []byte) error {
 	return nil
 }
 
+func (bdp *memoryMap) PutIfAbsent(key []byte, value []byte) (bool, error) {
+	bdp.lock.Lock()
+	defer bdp.lock.Unlock()
+	if bdp.db == nil {
+		bdp.db = make(map[string][]byte)
+	}
+	k := string(key)
+	if _, ok := bdp.db[k]; ok {
+		return false, nil
+	}
+	cp := make([]byte, len(value))
+	copy(cp, value)
+	bdp.db[k] = cp
+	return true, nil
+}
+
 func (bdp *memoryMap) Get(key []byte) ([]byte, error) {
 	bdp.lock.RLock()
 	defer bdp.lock.RUnlock()
@@ -85,7 +109,7 @@ func (bdp *memoryMap) Keys(handler func(key []byte) error) error {
 func (bdp *memoryMap) Close() error { return nil } // NOP
 
 type memBatch struct {
-	data map[string][]byte
+	data map[string][]byte // nil value means removed key
 	mm   *memoryMap
 }
 
@@ -96,6 +120,11 @@ func (mb *memBatch) Put(key []byte, value []byte) error {
 	return nil
 }
 
+func (mb *memBatch) Del(key []byte) error {
+	mb.data[string(key)] = nil
+	return nil
+}
+
 func (mb *memBatch) Close() error {
 	mb.mm.lock.Lock()
 	defer mb.mm.lock.Unlock()
@@ -103,7 +132,11 @@ func (mb *memBatch) Close() error {
 		mb.mm.db = make(map[string][]byte)
 	}
 	for k, v := range mb.data {
-		mb.mm.db[k] = v
+		if v == nil {
+			delete(mb.mm.db, k)
+		} else {
+			mb.mm.db[k] = v
+		}
 	}
 	mb.data = nil
 	return nil
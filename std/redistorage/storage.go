@@ -1,11 +1,13 @@
 package redistorage
 
 import (
+	"context"
 	"github.com/go-redis/redis"
 	"github.com/reddec/storages"
 	"github.com/reddec/storages/std"
 	"net/url"
 	"os"
+	"time"
 )
 
 type redisStorage struct {
@@ -45,6 +47,11 @@ func (rs *redisStorage) Put(key []byte, data []byte) error {
 	return rs.client.HSet(rs.key, string(key), data).Err()
 }
 
+// Put value if key does not exist by HSETNX
+func (rs *redisStorage) PutIfAbsent(key []byte, data []byte) (bool, error) {
+	return rs.client.HSetNX(rs.key, string(key), data).Result()
+}
+
 func (rs *redisStorage) Get(key []byte) ([]byte, error) {
 	cmd := rs.client.HGet(rs.key, string(key))
 	if cmd.Err() == redis.Nil {
@@ -77,6 +84,48 @@ func (rs *redisStorage) Keys(handler func(key []byte) error) error {
 	return nil
 }
 
+// Notify one waiter of key by pushing token to the list <hash key>:notify:<key>. List keeps at most one token
+// and expires after a minute if nobody waits
+func (rs *redisStorage) Notify(key []byte) error {
+	list := rs.notifyKey(key)
+	_, err := rs.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(list, "1")
+		pipe.LTrim(list, 0, 0)
+		pipe.Expire(list, time.Minute)
+		return nil
+	})
+	return err
+}
+
+// Wait for notification of key by BLPOP. Context is checked every second: notification received after context is
+// done is returned to the list for other waiters
+func (rs *redisStorage) Wait(ctx context.Context, key []byte) error {
+	list := rs.notifyKey(key)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := rs.client.BLPop(time.Second, list).Err()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			// waiter is gone, so notification belongs to others
+			if err := rs.Notify(key); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+		return nil
+	}
+}
+
+func (rs *redisStorage) notifyKey(key []byte) string {
+	return rs.key + ":notify:" + string(key)
+}
+
 func (rs *redisStorage) Close() error {
 	if rs.nested {
 		return nil
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"github.com/reddec/storages"
 	"io/ioutil"
 	"log"
@@ -19,6 +20,9 @@ import (
 // POST,PUT,PATCH /:key - update or insert value for key. Returns 204 on success. key should be base64 encoded
 //
 // DELETE /:key - remove key. Returns 204 on success. key should be base64 encoded
+//
+// GET /_health - JSON array of backend storages status if storage implements storages.HealthReporter.
+// Returns 200 if at least one backend is healthy, otherwise 503
 func NewServer(backed storages.Storage) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +36,10 @@ func NewServer(backed storages.Storage) http.Handler {
 				return
 			}
 		}
+		if reporter, ok := backed.(storages.HealthReporter); ok && r.URL.Path == healthPath {
+			getHealth(reporter, w, r)
+			return
+		}
 		key, err := base64.StdEncoding.DecodeString(r.URL.Path[1:])
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -52,6 +60,33 @@ func NewServer(backed storages.Storage) http.Handler {
 	return mux
 }
 
+// underscore is not a part of base64 alphabet so path will not collide with keys
+const healthPath = "/_health"
+
+func getHealth(reporter storages.HealthReporter, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "no method", http.StatusMethodNotAllowed)
+		return
+	}
+	status := reporter.Health()
+	data, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var code = http.StatusServiceUnavailable
+	for _, replica := range status {
+		if replica.Healthy {
+			code = http.StatusOK
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
 func listKeys(backed storages.Storage, w http.ResponseWriter, r *http.Request) {
 	var sent bool
 	err := backed.Keys(func(key []byte) error {
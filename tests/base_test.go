@@ -92,6 +92,7 @@ func TestRedundancy(t *testing.T) {
 	rdr := storages.RedundantAll(dedup.Offloaded(memstorage.New()), used...)
 	defer rdr.Close()
 
+	testShouldBeNS(t, rdr)
 	testStorage(t, rdr, "", true)
 }
 
@@ -105,6 +106,7 @@ func TestShard(t *testing.T) {
 
 	shard := storages.Sharded(pool)
 
+	testShouldBeNS(t, shard)
 	testStorage(t, shard, "", true)
 
 	if err := shard.Put([]byte("alice"), []byte("1")); err != nil {
@@ -128,6 +130,31 @@ func TestShard(t *testing.T) {
 	t.Logf("1st: %+v, 2nd: %+v, 3d: %+v", first, second, third)
 }
 
+func TestNotNamespaced(t *testing.T) {
+	plain := struct{ storages.Storage }{memstorage.New()}
+
+	rdr := storages.RedundantAll(dedup.Offloaded(memstorage.New()), memstorage.New(), plain).WithParallelKeys(2)
+	if _, ok := rdr.(storages.NamespacedStorage); ok {
+		t.Error("redundant storage over not namespaced storage should not be namespaced")
+	}
+	testShouldBeNS(t, storages.RedundantAll(dedup.Offloaded(memstorage.New()), memstorage.New()).WithParallelKeys(2))
+
+	pool := sharded.NewHashed(2, func(shardID uint32) (storages.Storage, error) {
+		if shardID == 1 {
+			return plain, nil
+		}
+		return memstorage.New(), nil
+	})
+	shard := storages.Sharded(pool).WithParallelKeys(2)
+	if _, ok := shard.(storages.NamespacedStorage); ok {
+		t.Error("sharded storage over not namespaced shard should not be namespaced")
+	}
+	pool = sharded.NewHashed(2, func(shardID uint32) (storages.Storage, error) {
+		return memstorage.New(), nil
+	})
+	testShouldBeNS(t, storages.Sharded(pool).WithParallelKeys(2))
+}
+
 func TestBolt(t *testing.T) {
 	testFile := "../test/boltd.db"
 	stor, err := boltdb.NewDefault(testFile)
@@ -284,12 +311,76 @@ func testStorage(t *testing.T, storage storages.Storage, testDir string, testNes
 		return
 	}
 
+	if ordered, ok := storage.(storages.OrderedStorage); ok {
+		t.Log("testing ordered keys")
+		testOrdered(ordered, t)
+	}
+
+	if atomicStorage, ok := storage.(storages.AtomicStorage); ok {
+		t.Log("testing atomic put")
+		testAtomic(atomicStorage, t)
+	}
+
 	if ns, ok := storage.(storages.NamespacedStorage); ok && testNested {
 		t.Log("testing namespaces")
 		testNamespaces(ns, t, testNested)
 	}
 }
 
+func testOrdered(storage storages.OrderedStorage, t *testing.T) {
+	keys := []string{"range-c", "range-a", "range-b", "range-d"}
+	for _, key := range keys {
+		err := storage.Put([]byte(key), []byte(key))
+		if err != nil {
+			t.Error("put", key, err)
+			return
+		}
+		defer storage.Del([]byte(key))
+	}
+	var found []string
+	err := storage.KeysRange([]byte("range-b"), []byte("range-d"), func(key []byte) error {
+		found = append(found, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Error("keys range:", err)
+		return
+	}
+	if len(found) != 2 || found[0] != "range-b" || found[1] != "range-c" {
+		t.Error("keys in range [range-b, range-d) should be range-b, range-c, got", found)
+	}
+}
+
+func testAtomic(storage storages.AtomicStorage, t *testing.T) {
+	defer storage.Del([]byte("test3"))
+	stored, err := storage.PutIfAbsent([]byte("test3"), []byte("first"))
+	if err != nil {
+		t.Error("put if absent test3:", err)
+		return
+	}
+	if !stored {
+		t.Error("absent key test3 should be stored")
+		return
+	}
+	stored, err = storage.PutIfAbsent([]byte("test3"), []byte("second"))
+	if err != nil {
+		t.Error("put if absent existent test3:", err)
+		return
+	}
+	if stored {
+		t.Error("existent key test3 should not be overwritten")
+		return
+	}
+	data, err := storage.Get([]byte("test3"))
+	if err != nil {
+		t.Error("get test3:", err)
+		return
+	}
+	if string(data) != "first" {
+		t.Error("corrupted value for test3:", string(data))
+	}
+}
+
 func testNamespaces(storage storages.NamespacedStorage, t *testing.T, testNested bool) {
 	err := storage.Namespaces(func(name []byte) error {
 		t.Log("warning! Already exists namespace in empty storage:", string(name))
@@ -355,4 +446,48 @@ func testNamespaces(storage storages.NamespacedStorage, t *testing.T, testNested
 		t.Error("removed namespace still exists")
 		return
 	}
+
+	if existing, ok := storage.(storages.ExistingNamespacedStorage); ok {
+		t.Log("testing existing namespaces")
+		testExistingNamespace(existing, t)
+	}
+}
+
+func testExistingNamespace(storage storages.ExistingNamespacedStorage, t *testing.T) {
+	_, err := storage.ExistingNamespace([]byte("test2"))
+	if err != os.ErrNotExist {
+		t.Error("absent namespace test2 caused NOT ErrNotExist error:", err)
+		return
+	}
+	list, err := storages.AllNamespacesString(storage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, k := range list {
+		if k == "test2" {
+			t.Error("absent namespace created")
+			return
+		}
+	}
+	ns, err := storage.Namespace([]byte("test2"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer storage.DelNamespace([]byte("test2"))
+	err = ns.Put([]byte("A"), []byte("B"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	existing, err := storage.ExistingNamespace([]byte("test2"))
+	if err != nil {
+		t.Error("get existing namespace test2:", err)
+		return
+	}
+	data, err := existing.Get([]byte("A"))
+	if err != nil || string(data) != "B" {
+		t.Error("corrupted value in existing namespace test2:", string(data), err)
+	}
 }
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/dedup"
+	"github.com/reddec/storages/std/memstorage"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedundancyHealth(t *testing.T) {
+	alive := memstorage.New()
+	dead := memstorage.New()
+	var isDead int32 = 1
+
+	rdr := storages.RedundantAll(dedup.Offloaded(memstorage.New()), dead, alive)
+	rdr.WithHealthCheck(10*time.Millisecond, func(storage storages.Storage) error {
+		if storage == dead && atomic.LoadInt32(&isDead) == 1 {
+			return errors.New("dead")
+		}
+		return nil
+	})
+	defer rdr.Close()
+
+	waitHealth(t, rdr, false)
+	status := rdr.Health()
+	assert.Len(t, status, 2)
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, "dead", status[0].LastError)
+	assert.True(t, status[1].Healthy)
+
+	// unhealthy storage is excluded, so write to all storages can not be completed
+	if err := rdr.Put([]byte("alice"), []byte("1")); err == nil {
+		t.Fatal("write quorum is not reached but no error")
+	}
+	_, err := dead.Get([]byte("alice"))
+	assert.Equal(t, os.ErrNotExist, err)
+	value, err := alive.Get([]byte("alice"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+
+	// recovery
+	atomic.StoreInt32(&isDead, 0)
+	waitHealth(t, rdr, true)
+	if err := rdr.Put([]byte("bob"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	value, err = dead.Get([]byte("bob"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(value))
+
+	// removing is applied to all storages regardless of health
+	atomic.StoreInt32(&isDead, 1)
+	waitHealth(t, rdr, false)
+	if err := rdr.Del([]byte("bob")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = dead.Get([]byte("bob"))
+	assert.Equal(t, os.ErrNotExist, err)
+}
+
+func waitHealth(t *testing.T, reporter storages.HealthReporter, healthy bool) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		status := reporter.Health()
+		if !status[0].LastCheck.IsZero() && status[0].Healthy == healthy {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("health status not changed")
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/dedup"
+	"github.com/reddec/storages/sharded"
+	"github.com/reddec/storages/std/memstorage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShardParallel(t *testing.T) {
+	pool := sharded.NewHashed(8, func(shardID uint32) (storage storages.Storage, e error) {
+		return memstorage.New(), nil
+	})
+	shard := storages.Sharded(pool).WithParallelKeys(3)
+	defer shard.Close()
+	testStorage(t, shard, "", true)
+
+	for i := 0; i < 100; i++ {
+		if err := shard.Put([]byte(fmt.Sprint("key-", i)), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var seen = make(map[string]bool)
+	err := shard.Keys(func(key []byte) error {
+		seen[string(key)] = true // serialized handler: no lock required
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, seen, 100)
+
+	// first error cancels iteration
+	var calls int
+	expected := errors.New("stop")
+	err = shard.Keys(func(key []byte) error {
+		calls++
+		return expected
+	})
+	assert.Equal(t, expected, err)
+	assert.Equal(t, 1, calls, "handler called after error")
+}
+
+func TestRedundancyParallel(t *testing.T) {
+	var used []storages.Storage
+	for i := 0; i < 4; i++ {
+		used = append(used, memstorage.New())
+	}
+	rdr := storages.RedundantAll(dedup.Offloaded(memstorage.New()), used...).WithParallelKeys(2)
+	defer rdr.Close()
+	testStorage(t, rdr, "", true)
+
+	for i := 0; i < 50; i++ {
+		if err := rdr.Put([]byte(fmt.Sprint("key-", i)), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := storages.AllKeys(rdr)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 50)
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/reddec/storages"
+	"github.com/reddec/storages/pubsub"
+	"github.com/reddec/storages/std/memstorage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	topic, err := pubsub.NewTopic(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := topic.Subscribe("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := topic.Subscribe("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.WithVisibilityTimeout(20 * time.Millisecond)
+	if err := topic.Publish([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// each subscription receives own copy
+	msg, err := second.Receive(ctx)
+	if err != nil || string(msg.Data) != "hello" {
+		t.Fatal("unexpected message", msg, err)
+	}
+	if err := msg.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	// failed processing should be delivered again
+	var calls int
+	listenCtx, stop := context.WithCancel(ctx)
+	err = first.Listen(listenCtx, func(data []byte) error {
+		calls++
+		if calls == 1 {
+			return context.Canceled
+		}
+		stop()
+		return nil
+	})
+	if err != context.Canceled || calls != 2 {
+		t.Fatal("message should be redelivered:", calls, err)
+	}
+
+	// subscriptions should be restored
+	topic, err = pubsub.NewTopic(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := topic.Subscriptions(); len(names) != 2 {
+		t.Fatal("subscriptions not restored", names)
+	}
+	if err := topic.Unsubscribe("first"); err != nil {
+		t.Fatal(err)
+	}
+	second, _ = topic.Subscription("second")
+	go topic.Publish([]byte("world"))
+	msg, ok := <-second.Messages(ctx)
+	if !ok || string(msg.Data) != "world" {
+		t.Fatal("message not received by channel")
+	}
+
+	// subscription created by another instance after opening of topic receives data
+	publisher, err := pubsub.NewTopic(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := topic.Subscribe("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish([]byte("late")); err != nil {
+		t.Fatal(err)
+	}
+	lateCtx, lateCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer lateCancel()
+	msg, err = third.Receive(lateCtx)
+	if err != nil || string(msg.Data) != "late" {
+		t.Fatal("new subscription should receive data from another instance:", err)
+	}
+}
+
+func TestPubSubRemovedByOther(t *testing.T) {
+	storage := &closingNamespaces{NamespacedStorage: memstorage.New()}
+	local, err := pubsub.NewTopic(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	sub, err := local.Subscribe("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := pubsub.NewTopic(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	if err := remote.Unsubscribe("s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Publish([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if names := local.Subscriptions(); len(names) != 0 {
+		t.Fatal("removed subscription should not be listed", names)
+	}
+	// local user of removed subscription should not get errors of closed storage
+	if err := sub.Queue().Put([]byte("local")); err != nil {
+		t.Fatal("removed subscription should be still usable, got", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil || string(msg.Data) != "local" {
+		t.Fatal("removed subscription should be still usable, got", err)
+	}
+}
+
+// namespaced storage with namespaces that fail after close
+type closingNamespaces struct {
+	storages.NamespacedStorage
+}
+
+func (cn *closingNamespaces) Namespace(name []byte) (storages.Storage, error) {
+	ns, err := cn.NamespacedStorage.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return &closingStorage{Storage: ns}, nil
+}
+
+type closingStorage struct {
+	storages.Storage
+	closed int32
+}
+
+func (cs *closingStorage) Get(key []byte) ([]byte, error) {
+	if atomic.LoadInt32(&cs.closed) == 1 {
+		return nil, errors.New("storage closed")
+	}
+	return cs.Storage.Get(key)
+}
+
+func (cs *closingStorage) Put(key []byte, data []byte) error {
+	if atomic.LoadInt32(&cs.closed) == 1 {
+		return errors.New("storage closed")
+	}
+	return cs.Storage.Put(key, data)
+}
+
+func (cs *closingStorage) Close() error {
+	atomic.StoreInt32(&cs.closed, 1)
+	return nil
+}
+
+func TestPubSubREST(t *testing.T) {
+	topic, err := pubsub.NewTopic(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(pubsub.NewServer(topic))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/subscriptions/s1", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("subscribe failed", res.StatusCode)
+	}
+	res, err = http.Post(server.URL+"/publish", "text/plain", bytes.NewBufferString("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = http.Post(server.URL+"/subscriptions/s1/reserve", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(data) != "hello" {
+		t.Fatal("reserve failed", res.StatusCode, string(data))
+	}
+	res, err = http.Post(server.URL+"/subscriptions/s1/ack/"+res.Header.Get("X-Message-Id"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("ack failed", res.StatusCode)
+	}
+}
@@ -1,11 +1,22 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
 	"github.com/reddec/storages"
 	"github.com/reddec/storages/queues"
+	"github.com/reddec/storages/sharded"
 	"github.com/reddec/storages/std/memstorage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestQueueNQ(t *testing.T) {
@@ -140,3 +151,946 @@ func testQueue(queueFactory func() (storages.Queue, error), t *testing.T) {
 		return
 	}
 }
+
+func TestQueueReliable(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.Reliable(mem)
+	}, t)
+
+	mem = memstorage.New()
+	q, err := queues.Reliable(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"alice", "bob", "clark"} {
+		if err := q.Put([]byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reserve and ack
+	id, data, err := q.Reserve(time.Minute)
+	if err != nil {
+		t.Fatal("reserve:", err)
+	}
+	if string(data) != "alice" {
+		t.Fatal("where is alice")
+	}
+	if err := q.Ack(id); err != nil {
+		t.Fatal("ack:", err)
+	}
+	if err := q.Ack(id); err != os.ErrNotExist {
+		t.Fatal("double ack should be not exists:", err)
+	}
+	// reserve and nack: should be delivered again
+	id, data, err = q.Reserve(time.Minute)
+	if err != nil || string(data) != "bob" {
+		t.Fatal("where is bob:", err)
+	}
+	if err := q.Nack(id); err != nil {
+		t.Fatal("nack:", err)
+	}
+	again, data, err := q.Reserve(10 * time.Millisecond)
+	if err != nil || string(data) != "bob" || again != id {
+		t.Fatal("bob not returned after nack:", err)
+	}
+	// not acknowledged till timeout - should be visible again even after restart
+	time.Sleep(20 * time.Millisecond)
+	q, err = queues.Reliable(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, data, err = q.Reserve(time.Minute)
+	if err != nil || string(data) != "bob" || again != id {
+		t.Fatal("bob not returned after timeout:", err)
+	}
+	_, data, err = q.Reserve(time.Minute)
+	if err != nil || string(data) != "clark" {
+		t.Fatal("where is clark:", err)
+	}
+	_, _, err = q.Reserve(time.Minute)
+	if err != os.ErrNotExist {
+		t.Fatal("queue should be empty:", err)
+	}
+	if q.InFlight() != 2 {
+		t.Fatal("expected 2 in-flight records, got", q.InFlight())
+	}
+	// in-flight records are restored after restart
+	if err := q.Ack(id); err != nil {
+		t.Fatal("ack:", err)
+	}
+	q, err = queues.Reliable(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.InFlight() != 1 {
+		t.Fatal("expected 1 in-flight record after restart, got", q.InFlight())
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	dlq, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := queues.Reliable(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.WithDeadLetter(2, dlq)
+	if err := q.Put([]byte("poison")); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		id, data, err := q.Reserve(time.Minute)
+		if err != nil || string(data) != "poison" {
+			t.Fatal("reserve:", err)
+		}
+		if n, err := q.Attempts(id); err != nil || n != attempt {
+			t.Fatal("expected attempt", attempt, "got", n, err)
+		}
+		if err := q.Nack(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// third delivery should move record to dead-letter queue
+	if _, _, err := q.Reserve(time.Minute); err != os.ErrNotExist {
+		t.Fatal("poison record should be moved to dead-letter queue:", err)
+	}
+	if q.InFlight() != 0 {
+		t.Fatal("in-flight records left")
+	}
+	data, err := dlq.Peek()
+	if err != nil || string(data) != "poison" {
+		t.Fatal("poison record not in dead-letter queue:", err)
+	}
+	// redrive back
+	moved, err := queues.Redrive(dlq, q, 0)
+	if err != nil || moved != 1 {
+		t.Fatal("redrive:", moved, err)
+	}
+	if _, err := dlq.Peek(); err != os.ErrNotExist {
+		t.Fatal("dead-letter queue should be empty")
+	}
+	id, data, err := q.Reserve(time.Minute)
+	if err != nil || string(data) != "poison" {
+		t.Fatal("redrived record not delivered:", err)
+	}
+	if n, _ := q.Attempts(id); n != 1 {
+		t.Fatal("attempts should be reset after redrive")
+	}
+}
+
+func TestQueueDelayed(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.Delayed(mem)
+	}, t)
+
+	mem = memstorage.New()
+	q, err := queues.Delayed(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := q.PutAt([]byte("later"), now.Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutAt([]byte("past"), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := q.Get()
+	if err != nil || string(data) != "past" {
+		t.Fatal("past record should be available:", err)
+	}
+	if _, err := q.Get(); err != os.ErrNotExist {
+		t.Fatal("record should not be available before due time:", err)
+	}
+	// schedule should be restored
+	q, err = queues.Delayed(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := q.Next(); !ok || next.UnixNano() != now.Add(50*time.Millisecond).UnixNano() {
+		t.Fatal("schedule not restored")
+	}
+	time.Sleep(60 * time.Millisecond)
+	data, err = q.Get()
+	if err != nil || string(data) != "later" {
+		t.Fatal("delayed record should be available:", err)
+	}
+	// record removed from storage directly is skipped
+	if err := q.PutAt([]byte("removed"), now.Add(-2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutAt([]byte("kept"), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := storages.AllKeys(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if value, _ := mem.Get(key); string(value) == "removed" {
+			_ = mem.Del(key)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	data, err = q.GetWait(ctx)
+	if err != nil || string(data) != "kept" {
+		t.Fatal("removed record should be skipped:", string(data), err)
+	}
+	if _, ok := q.Next(); ok {
+		t.Fatal("schedule should be empty")
+	}
+}
+
+func TestQueueDelayedREST(t *testing.T) {
+	q, err := queues.Delayed(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(queues.NewServer(q))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(queues.DelayHeader, "1h")
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected status:", res.Status)
+	}
+	if next, ok := q.Next(); !ok || next.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatal("record not delayed")
+	}
+	res, err = server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatal("delayed record should not be visible:", res.Status)
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.Priority(mem, 3)
+	}, t)
+	// plain KV without namespaces
+	kv := struct{ storages.KV }{memstorage.New()}
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.Priority(kv, 3)
+	}, t)
+
+	q, err := queues.PriorityWeighted(memstorage.New(), []int{1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutPriority([]byte("x"), 2); err == nil {
+		t.Fatal("priority out of range accepted")
+	}
+	for i := 0; i < 4; i++ {
+		if err := q.PutPriority([]byte("low"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.PutPriority([]byte("high"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var order []string
+	for {
+		data, err := q.Get()
+		if err == os.ErrNotExist {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, string(data))
+	}
+	// low priority should not wait until all high priority records are consumed
+	expected := []string{"high", "high", "low", "high", "high", "low", "low", "low"}
+	if len(order) != len(expected) {
+		t.Fatal("expected", expected, "got", order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatal("expected", expected, "got", order)
+		}
+	}
+
+	// records added by another instance over the same storage are detected by polling
+	shared := memstorage.New()
+	consumer, err := queues.Priority(shared, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer, err := queues.Priority(shared, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		producer.PutPriority([]byte("remote"), 1)
+	}()
+	// concurrent reading during reload of levels
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				consumer.Peek()
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*queues.DefaultPollInterval)
+	defer cancel()
+	data, err := consumer.GetWait(ctx)
+	if err != nil || string(data) != "remote" {
+		t.Fatal("record from another instance should be received:", err)
+	}
+}
+
+func TestQueueGetWait(t *testing.T) {
+	naive, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	priority, err := queues.Priority(memstorage.New(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delayed, err := queues.Delayed(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []storages.BlockingQueue{naive, priority, delayed} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = q.GetWait(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatal("empty queue should block until deadline:", err)
+		}
+		go func(q storages.Queue) {
+			time.Sleep(20 * time.Millisecond)
+			q.Put([]byte("hello"))
+		}(q)
+		ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+		data, err := q.GetWait(ctx)
+		cancel()
+		if err != nil || string(data) != "hello" {
+			t.Fatal("waiter should be notified:", err)
+		}
+	}
+	// delayed record should be returned after due time without notification
+	if err := delayed.PutAfter([]byte("later"), 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	data, err := delayed.GetWait(ctx)
+	if err != nil || string(data) != "later" {
+		t.Fatal("delayed record should be returned after due time:", err)
+	}
+}
+
+func TestQueueGetWaitREST(t *testing.T) {
+	q, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(queues.NewServer(q))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/?wait=20ms", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatal("expected 404 after wait, got", res.StatusCode)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Put([]byte("hello"))
+	}()
+	req, _ = http.NewRequest(http.MethodDelete, server.URL+"/?wait=1s", nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(data) != "hello" {
+		t.Fatal("long-polling failed:", res.StatusCode, string(data))
+	}
+}
+
+func TestQueueBatch(t *testing.T) {
+	batched := memstorage.New()
+	plain := struct{ storages.KV }{memstorage.New()}
+	for _, storage := range []storages.KV{batched, plain} {
+		q, err := queues.NaiveQueue(storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Put([]byte("0")); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.PutBatch([][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4")}); err != nil {
+			t.Fatal(err)
+		}
+		items, err := q.GetBatch(3)
+		if err != nil || len(items) != 3 || string(items[0]) != "0" || string(items[2]) != "2" {
+			t.Fatal("unexpected batch", items, err)
+		}
+		// sequences should be saved
+		q, err = queues.NaiveQueue(storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items, err = q.GetBatch(10)
+		if err != nil || len(items) != 2 || string(items[0]) != "3" || string(items[1]) != "4" {
+			t.Fatal("unexpected batch", items, err)
+		}
+		if _, err := q.GetBatch(10); err != os.ErrNotExist {
+			t.Fatal("empty queue returned batch:", err)
+		}
+	}
+}
+
+func TestQueueBatchREST(t *testing.T) {
+	q, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(queues.NewServer(q))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, queues.JSONContentType, bytes.NewBufferString(`["a", {"b": 1}, "x\ny"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	// strings are stored unquoted, other values as-is
+	var stored []string
+	err = q.Range(0, func(id uint64, data []byte) error {
+		stored = append(stored, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a", `{"b": 1}`, "x\ny"}, stored)
+	res, err = http.Post(server.URL, queues.NDJSONContentType, bytes.NewBufferString("c\n\nd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected status", res.StatusCode)
+	}
+	items, err := q.GetBatch(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a", `{"b": 1}`, "x\ny", "c", "d"}
+	if len(items) != len(expected) {
+		t.Fatal("expected", expected, "got", len(items))
+	}
+	for i := range expected {
+		if string(items[i]) != expected[i] {
+			t.Fatal("expected", expected[i], "got", string(items[i]))
+		}
+	}
+
+	// single JSON value is one message
+	res, err = http.Post(server.URL, queues.JSONContentType, bytes.NewBufferString(`{"e": [1, 2]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected status", res.StatusCode)
+	}
+	data, err := q.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"e": [1, 2]}`, string(data))
+}
+
+func TestQueueLog(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	log, err := queues.Log(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"a", "b", "c"} {
+		if _, err := log.Append([]byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := log.Group("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := log.Group("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// groups read the same entries independently
+	for _, group := range []interface {
+		Next() (*queues.LogEntry, error)
+		Commit(offset uint64) error
+	}{first, second} {
+		entry, err := group.Next()
+		if err != nil || string(entry.Data) != "a" || entry.Offset != 1 {
+			t.Fatal("unexpected entry", entry, err)
+		}
+		if err := group.Commit(entry.Offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, err := first.Next()
+	if err != nil || string(entry.Data) != "b" {
+		t.Fatal("unexpected entry", entry, err)
+	}
+	// not committed entry should be delivered after restart
+	log, err = queues.Log(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := log.Groups(); len(groups) != 2 {
+		t.Fatal("groups not restored", groups)
+	}
+	first, _ = log.Group("first")
+	entry, err = first.Next()
+	if err != nil || string(entry.Data) != "b" {
+		t.Fatal("uncommitted entry should be delivered again", entry, err)
+	}
+	if err := first.Commit(3); err != nil {
+		t.Fatal(err)
+	}
+	// not appended and already committed offsets are rejected
+	if err := first.Commit(4); errors.Cause(err) != queues.ErrInvalidOffset {
+		t.Fatal("offset after the latest entry should be rejected:", err)
+	}
+	if err := first.Commit(2); errors.Cause(err) != queues.ErrInvalidOffset {
+		t.Fatal("committed offset should not be moved backward:", err)
+	}
+	if _, err := first.Next(); err != os.ErrNotExist {
+		t.Fatal("all entries should be consumed:", err)
+	}
+	// only entries consumed by all groups are removed
+	removed, err := log.Retain(0)
+	if err != nil || removed != 1 {
+		t.Fatal("expected 1 removed entry, got", removed, err)
+	}
+	if _, err := log.Read(1); err != os.ErrNotExist {
+		t.Fatal("entry should be removed")
+	}
+	second, _ = log.Group("second")
+	if lag := second.Lag(); lag != 2 {
+		t.Fatal("expected lag 2, got", lag)
+	}
+	// removing by age
+	time.Sleep(10 * time.Millisecond)
+	removed, err = log.Retain(5 * time.Millisecond)
+	if err != nil || removed != 2 {
+		t.Fatal("expected 2 removed entries, got", removed, err)
+	}
+	if _, err := second.Next(); err != os.ErrNotExist {
+		t.Fatal("removed entries should be skipped:", err)
+	}
+	if err := log.DelGroup("second"); err != nil {
+		t.Fatal(err)
+	}
+	if groups := log.Groups(); len(groups) != 1 {
+		t.Fatal("group not removed", groups)
+	}
+}
+
+func TestQueueBounded(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.Bounded(mem, 10, queues.Reject)
+	}, t)
+
+	reject, err := queues.Bounded(memstorage.New(), 2, queues.Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reject.Put([]byte("a"))
+	reject.Put([]byte("b"))
+	if err := reject.Put([]byte("c")); err != queues.ErrQueueFull {
+		t.Fatal("full queue accepted data:", err)
+	}
+	if reject.Len() != 2 || reject.Cap() != 2 {
+		t.Fatal("unexpected len/cap", reject.Len(), reject.Cap())
+	}
+
+	drop, err := queues.Bounded(memstorage.New(), 2, queues.DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"a", "b", "c"} {
+		if err := drop.Put([]byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := drop.Peek(); string(data) != "b" {
+		t.Fatal("oldest data should be dropped, got", string(data))
+	}
+
+	storage := memstorage.New()
+	sized, err := queues.BoundedBytes(storage, 5, queues.DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sized.Put([]byte("abc"))
+	sized.Put([]byte("de"))
+	sized.Put([]byte("f"))
+	if data, _ := sized.Peek(); string(data) != "de" || sized.Bytes() != 3 {
+		t.Fatal("unexpected state", string(data), sized.Bytes())
+	}
+	if err := sized.Put([]byte("too long")); err != queues.ErrQueueFull {
+		t.Fatal("too long data accepted:", err)
+	}
+	// size should be restored
+	sized, err = queues.BoundedBytes(storage, 5, queues.DropOldest)
+	if err != nil || sized.Bytes() != 3 {
+		t.Fatal("size not restored", err)
+	}
+	// records removed in the middle are skipped
+	if err := sized.Put([]byte("g")); err != nil {
+		t.Fatal(err)
+	}
+	naive, err := queues.NaiveQueue(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := naive.DeleteByID(3); err != nil {
+		t.Fatal(err)
+	}
+	sized, err = queues.BoundedBytes(storage, 5, queues.DropOldest)
+	if err != nil || sized.Bytes() != 3 {
+		t.Fatal("size not restored after delete by id", err)
+	}
+
+	block, err := queues.Bounded(memstorage.New(), 1, queues.Block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Put([]byte("a"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	err = block.PutWait(ctx, []byte("b"))
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatal("put to full queue should block:", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- block.Put([]byte("b")) }()
+	time.Sleep(10 * time.Millisecond)
+	if data, err := block.Get(); err != nil || string(data) != "a" {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if data, err := block.Get(); err != nil || string(data) != "b" {
+		t.Fatal("blocked data not added", err)
+	}
+}
+
+func TestQueueBoundedREST(t *testing.T) {
+	q, err := queues.Bounded(memstorage.New(), 1, queues.Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(queues.NewServer(q))
+	defer server.Close()
+	for i, expected := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		res, err := http.Post(server.URL, "text/plain", bytes.NewBufferString("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != expected {
+			t.Fatal("request", i, "expected", expected, "got", res.StatusCode)
+		}
+	}
+}
+
+func TestQueueBrowse(t *testing.T) {
+	mem := memstorage.New()
+	q, err := queues.NaiveQueue(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"a", "b", "c", "d"} {
+		q.Put([]byte(value))
+	}
+	if q.Len() != 4 {
+		t.Fatal("expected 4 records, got", q.Len())
+	}
+	if err := q.DeleteByID(2); err != nil {
+		t.Fatal(err)
+	}
+	// deleted records are not counted even after restart
+	if q.Len() != 3 {
+		t.Fatal("expected 3 records, got", q.Len())
+	}
+	q, err = queues.NaiveQueue(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 3 {
+		t.Fatal("expected 3 records after restart, got", q.Len())
+	}
+	var ids []uint64
+	err = q.Range(0, func(id uint64, data []byte) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil || len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 4 {
+		t.Fatal("unexpected ids", ids, err)
+	}
+	if data, _ := q.Get(); string(data) != "a" {
+		t.Fatal("expected a, got", string(data))
+	}
+	// deleted record should be skipped
+	if data, _ := q.Get(); string(data) != "c" {
+		t.Fatal("expected c, got", string(data))
+	}
+	if q.Len() != 1 {
+		t.Fatal("expected 1 record, got", q.Len())
+	}
+	if err := q.DeleteByID(4); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 {
+		t.Fatal("queue should be empty, got", q.Len())
+	}
+	if err := q.DeleteByID(4); err != os.ErrNotExist {
+		t.Fatal("deleted record removed again:", err)
+	}
+	q.Put([]byte("e"))
+	q.Put([]byte("f"))
+	if err := q.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(); err != os.ErrNotExist || q.Len() != 0 {
+		t.Fatal("purged queue is not empty:", err)
+	}
+}
+
+func TestQueueBrowseREST(t *testing.T) {
+	q, err := queues.NaiveQueue(memstorage.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.PutBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	server := httptest.NewServer(queues.NewServer(q))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/messages/2", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatal("delete failed", res.StatusCode)
+	}
+	res, err = http.Get(server.URL + "/messages?limit=1&from=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []queues.Message
+	err = json.NewDecoder(res.Body).Decode(&messages)
+	res.Body.Close()
+	if err != nil || len(messages) != 1 || messages[0].ID != 3 || string(messages[0].Data) != "c" {
+		t.Fatal("unexpected messages", messages, err)
+	}
+	res, err = http.Get(server.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats queues.Stats
+	err = json.NewDecoder(res.Body).Decode(&stats)
+	res.Body.Close()
+	if err != nil || stats.Length != 2 {
+		t.Fatal("deleted message should not be counted", stats, err)
+	}
+	res, err = http.Post(server.URL+"/purge", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = http.Get(server.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = queues.Stats{}
+	err = json.NewDecoder(res.Body).Decode(&stats)
+	res.Body.Close()
+	if err != nil || stats.Length != 0 {
+		t.Fatal("queue should be purged", stats, err)
+	}
+	// endpoint of not supported feature should not enqueue data
+	res, err = http.Post(server.URL+"/reserve", "", bytes.NewBufferString("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound || q.Len() != 0 {
+		t.Fatal("unknown endpoint accepted data", res.StatusCode, q.Len())
+	}
+}
+
+func TestQueuePartitioned(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		return queues.PartitionedNamespaces(mem, 3)
+	}, t)
+
+	pool := sharded.NewHashedArray([]storages.Storage{memstorage.New(), memstorage.New()})
+	q, err := queues.PartitionedPool(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Partitions() != 2 {
+		t.Fatal("expected 2 partitions, got", q.Partitions())
+	}
+	key := []byte("user-1")
+	for _, value := range []string{"1", "2", "3"} {
+		if err := q.PutKey(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Put([]byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 4 {
+		t.Fatal("expected 4 records, got", q.Len())
+	}
+	// order by key should be kept
+	var last string
+	for i := 0; i < 4; i++ {
+		data, err := q.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) == "other" {
+			continue
+		}
+		if string(data) <= last {
+			t.Fatal("order of key is broken:", last, string(data))
+		}
+		last = string(data)
+	}
+	if _, err := q.Get(); err != os.ErrNotExist {
+		t.Fatal("queue should be empty:", err)
+	}
+
+	// discard removes peeked data even if data appeared in partition before it
+	var keys [2][]byte
+	for i := 0; keys[0] == nil || keys[1] == nil; i++ {
+		key := []byte(fmt.Sprint("key-", i))
+		keys[q.Partition(key)] = key
+	}
+	// move read cursor to the first partition
+	if err := q.PutKey(keys[1], []byte("skip")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutKey(keys[1], []byte("peeked")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := q.Peek(); err != nil || string(data) != "peeked" {
+		t.Fatal("unexpected peek", string(data), err)
+	}
+	if err := q.PutKey(keys[0], []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := q.Get(); err != nil || string(data) != "next" {
+		t.Fatal("peeked data should be discarded:", string(data), err)
+	}
+}
+
+func TestQueueLegacyMigration(t *testing.T) {
+	mem := memstorage.New()
+	defer mem.Close()
+	testQueue(func() (queue storages.Queue, err error) {
+		legacy, err := queues.Simple(mem)
+		if err != nil {
+			return nil, err
+		}
+		return queues.FromLegacy(legacy), nil
+	}, t)
+
+	storage := memstorage.New()
+	legacy, err := queues.Simple(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"a", "b", "c"} {
+		legacy.Put([]byte(value))
+	}
+	// in place
+	moved, err := queues.MigrateToNaive(storage, storage)
+	if err != nil || moved != 3 {
+		t.Fatal("expected 3 moved records, got", moved, err)
+	}
+	naive, err := queues.NaiveQueue(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := naive.Peek(); string(data) != "a" || naive.Len() != 3 {
+		t.Fatal("unexpected state after migration", string(data), naive.Len())
+	}
+	// to new storage and back
+	target := memstorage.New()
+	moved, err = queues.MigrateToLegacy(storage, target)
+	if err != nil || moved != 3 {
+		t.Fatal("expected 3 moved records, got", moved, err)
+	}
+	if keys, _ := storages.AllKeys(storage); len(keys) != 0 {
+		t.Fatal("source should be empty, got", len(keys), "keys")
+	}
+	legacy, err = queues.Simple(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Size() != 3 {
+		t.Fatal("expected 3 records, got", legacy.Size())
+	}
+	if _, data, _ := legacy.Peek(); string(data) != "c" {
+		t.Fatal("order is broken, latest is", string(data))
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"context"
+	"github.com/reddec/storages/std/redistorage"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRedisWaitCancel(t *testing.T) {
+	// REDIS should be installed and started on default port
+	stor, err := redistorage.New("signal", "redis://127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stor.Close()
+	if _, err := stor.Get([]byte("ping")); err != nil && err != os.ErrNotExist {
+		t.Skip("REDIS is not available:", err)
+	}
+	key := []byte("wait-cancel")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- stor.Wait(ctx, key) }()
+	time.Sleep(100 * time.Millisecond)
+	// notification after cancel should not be lost by canceled waiter
+	cancel()
+	if err := stor.Notify(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != context.Canceled {
+		t.Fatal("canceled waiter should return context error, got", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := stor.Wait(ctx, key); err != nil {
+		t.Fatal("notification should be delivered to another waiter:", err)
+	}
+}